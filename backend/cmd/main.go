@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
 	"os"
@@ -9,11 +10,16 @@ import (
 	"Social/pkg/api/handlers"
 	"Social/pkg/api/middlewares"
 	"Social/pkg/db"
+	"Social/pkg/services"
+	"Social/pkg/storage"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	rebuildCounters := flag.Bool("rebuild-counters", false, "recompute the comment and reaction counters, then exit")
+	flag.Parse()
+
 	// Load environment variables from .env file
 	err := godotenv.Load(".env")
 	if err != nil {
@@ -26,6 +32,27 @@ func main() {
 		log.Fatalf("Error initializing database: %v", err)
 	}
 
+	if *rebuildCounters {
+		if err := services.RebuildCounters(); err != nil {
+			log.Fatalf("Error rebuilding counters: %v", err)
+		}
+		log.Println("Counters rebuilt successfully")
+		return
+	}
+
+	// Uploaded media are kept on the local filesystem and processed into
+	// their variants in the background
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "../../uploads"
+	}
+	mediaStore, err := storage.NewLocalStore(mediaDir)
+	if err != nil {
+		log.Fatalf("Error initializing media storage: %v", err)
+	}
+	services.SetMediaStore(mediaStore)
+	services.StartMediaWorkers(services.MediaWorkers())
+
 	// Initialize the routes
 	mux := http.NewServeMux()
 	api.InitializeRoutes(mux)
@@ -4,11 +4,27 @@ import (
 	"Social/pkg/models"
 	"Social/pkg/services"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 )
 
-// CreateComment handles POST requests to create a comment
+// writeCommentError maps comment service errors to responses
+func writeCommentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrCommentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidParentComment), errors.Is(err, services.ErrCommentTooDeep),
+		errors.Is(err, services.ErrInvalidCommentMode), errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrInvalidMedia):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateComment handles POST requests to create a comment, or a reply to
+// another comment of the post when parent_id is given
 func CreateComment(w http.ResponseWriter, r *http.Request) {
 	var comment models.Comment
 	if err := json.NewDecoder(r.Body).Decode(&comment); err != nil {
@@ -16,21 +32,23 @@ func CreateComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("userID").(int)
+	// Comments can only be left on posts the user is allowed to see
+	userID, ok := authorize(w, r, services.ActionCommentOnPost, comment.PostID)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 	comment.UserID = userID
 
-	if err := services.CreateComment(comment); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	commentID, err := services.CreateComment(comment)
+	if err != nil {
+		writeCommentError(w, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Comment created successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Comment created successfully",
+		"comment_id": commentID,
 	})
 }
 
@@ -42,9 +60,14 @@ func GetComment(w http.ResponseWriter, r *http.Request, commentIDStr string) {
 		return
 	}
 
-	comment, err := services.GetComment(commentID)
+	userID, ok := authorize(w, r, services.ActionViewComment, commentID)
+	if !ok {
+		return
+	}
+
+	comment, err := services.GetComment(userID, commentID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCommentError(w, err)
 		return
 	}
 
@@ -68,8 +91,12 @@ func UpdateComment(w http.ResponseWriter, r *http.Request, commentIDStr string)
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionUpdateComment, commentID); !ok {
+		return
+	}
+
 	if err := services.UpdateComment(commentID, comment); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCommentError(w, err)
 		return
 	}
 
@@ -87,8 +114,12 @@ func DeleteComment(w http.ResponseWriter, r *http.Request, commentIDStr string)
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionDeleteComment, commentID); !ok {
+		return
+	}
+
 	if err := services.DeleteComment(commentID); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeCommentError(w, err)
 		return
 	}
 
@@ -97,3 +128,38 @@ func DeleteComment(w http.ResponseWriter, r *http.Request, commentIDStr string)
 		"message": "Comment deleted successfully",
 	})
 }
+
+// GetPostComments handles GET requests for a page of the comments of a post.
+// Query parameters: mode (tree or flat), cursor and limit.
+func GetPostComments(w http.ResponseWriter, r *http.Request, postIDStr string) {
+	postID, err := strconv.Atoi(postIDStr)
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := authorize(w, r, services.ActionViewPost, postID)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := services.GetPostComments(userID, postID, query.Get("mode"), query.Get("cursor"), limit)
+	if err != nil {
+		writeCommentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
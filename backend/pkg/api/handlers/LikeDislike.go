@@ -1,44 +1,17 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 
-	"Social/pkg/services"
+	"Social/pkg/models"
 )
 
-// LikePost handles POST requests to like a post
+// LikePost handles POST requests to like a post, or to take the like back
 func LikePost(w http.ResponseWriter, r *http.Request, postID int) {
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	err := services.LikePost(userID, postID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Post liked successfully"})
+	toggleReaction(w, r, models.ReactionTargetPost, postID, models.ReactionLike)
 }
 
-// DislikePost handles POST requests to dislike a post
+// DislikePost handles POST requests to dislike a post, or to take the dislike back
 func DislikePost(w http.ResponseWriter, r *http.Request, postID int) {
-	userID, ok := r.Context().Value("userID").(int)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	err := services.DislikePost(userID, postID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Post disliked successfully"})
+	toggleReaction(w, r, models.ReactionTargetPost, postID, models.ReactionDislike)
 }
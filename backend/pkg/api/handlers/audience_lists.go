@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"Social/pkg/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// audienceListRequest is the body of requests creating or updating an audience list
+type audienceListRequest struct {
+	Name      string `json:"name"`
+	MemberIDs []int  `json:"member_ids"`
+}
+
+// writeAudienceListError maps audience list service errors to responses
+func writeAudienceListError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidListName), errors.Is(err, services.ErrNotFollower):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrDuplicateListName):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// parseAudienceListID reads a list ID and checks that the current user owns the list
+func parseAudienceListID(w http.ResponseWriter, r *http.Request, listIDStr string) (int, bool) {
+	listID, err := strconv.Atoi(listIDStr)
+	if err != nil {
+		http.Error(w, "Invalid list ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if _, ok := authorize(w, r, services.ActionManageAudienceList, listID); !ok {
+		return 0, false
+	}
+	return listID, true
+}
+
+// GetAudienceLists handles GET requests for the audience lists of the current user
+func GetAudienceLists(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	lists, err := services.ListAudienceLists(userID)
+	if err != nil {
+		writeAudienceListError(w, err, "Failed to retrieve audience lists")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lists); err != nil {
+		http.Error(w, "Failed to encode audience lists: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateAudienceList handles POST requests to create a named list of followers
+func CreateAudienceList(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body audienceListRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := services.CreateAudienceList(userID, body.Name, body.MemberIDs)
+	if err != nil {
+		writeAudienceListError(w, err, "Failed to create audience list")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetAudienceList handles GET requests for one of the current user's audience lists
+func GetAudienceList(w http.ResponseWriter, r *http.Request, listIDStr string) {
+	listID, ok := parseAudienceListID(w, r, listIDStr)
+	if !ok {
+		return
+	}
+
+	list, err := services.GetAudienceList(listID)
+	if err != nil {
+		writeAudienceListError(w, err, "Failed to retrieve audience list")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(list); err != nil {
+		http.Error(w, "Failed to encode audience list: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// UpdateAudienceList handles PUT requests to rename a list and replace its members
+func UpdateAudienceList(w http.ResponseWriter, r *http.Request, listIDStr string) {
+	listID, ok := parseAudienceListID(w, r, listIDStr)
+	if !ok {
+		return
+	}
+
+	var body audienceListRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	list, err := services.UpdateAudienceList(listID, body.Name, body.MemberIDs)
+	if err != nil {
+		writeAudienceListError(w, err, "Failed to update audience list")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// DeleteAudienceList handles DELETE requests to remove one of the current user's audience lists
+func DeleteAudienceList(w http.ResponseWriter, r *http.Request, listIDStr string) {
+	listID, ok := parseAudienceListID(w, r, listIDStr)
+	if !ok {
+		return
+	}
+
+	if err := services.DeleteAudienceList(listID); err != nil {
+		writeAudienceListError(w, err, "Failed to delete audience list")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddAudienceListMember handles POST requests adding a follower, given as user_id, to a list
+func AddAudienceListMember(w http.ResponseWriter, r *http.Request, listIDStr string) {
+	listID, ok := parseAudienceListID(w, r, listIDStr)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := services.AddAudienceListMember(listID, body.UserID); err != nil {
+		writeAudienceListError(w, err, "Failed to add audience list member")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member added successfully"})
+}
+
+// RemoveAudienceListMember handles DELETE requests taking a user out of a list
+func RemoveAudienceListMember(w http.ResponseWriter, r *http.Request, listIDStr, userIDStr string) {
+	listID, ok := parseAudienceListID(w, r, listIDStr)
+	if !ok {
+		return
+	}
+	memberID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RemoveAudienceListMember(listID, memberID); err != nil {
+		writeAudienceListError(w, err, "Failed to remove audience list member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
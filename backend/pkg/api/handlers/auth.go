@@ -3,12 +3,8 @@ package handlers
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"path/filepath"
-	"time"
 
 	"Social/pkg/api/middlewares"
 	"Social/pkg/models"
@@ -21,14 +17,21 @@ import (
 
 func Register(w http.ResponseWriter, r *http.Request) {
 	// Parse the multipart form
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequestSize())
 	err := r.ParseMultipartForm(10 << 20) // 10 MB limit
 	if err != nil {
 		log.Println("Error parsing form:", err)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeMediaError(w, err)
+			return
+		}
 		http.Error(w, "Unable to parse form", http.StatusBadRequest)
 		return
 	}
 
 	var req models.RegisterRequest
+	req.Handle = r.FormValue("handle")
 	req.Email = r.FormValue("email")
 	req.Password = r.FormValue("password")
 	req.FirstName = r.FormValue("first_name")
@@ -40,28 +43,18 @@ func Register(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Registering user: %+v", req)
 
-	// Handle avatar file upload
+	// The avatar is optional and stored through the media service along
+	// with the account
 	file, _, err := r.FormFile("avatarUrl")
 	if err != nil && err != http.ErrMissingFile {
 		log.Println("Error retrieving avatar:", err)
 		http.Error(w, "Error retrieving avatar", http.StatusBadRequest)
 		return
 	}
-	defer func() {
-		if file != nil {
-			file.Close()
-		}
-	}()
-
-	// Save the avatar file
-	if err == nil { // If a file is uploaded
-		avatarPath, err := saveAvatar(file)
-		if err != nil {
-			log.Println("Failed to save avatar:", err)
-			http.Error(w, "Failed to save avatar", http.StatusInternalServerError)
-			return
-		}
-		req.Avatar = avatarPath
+	var avatar io.Reader
+	if file != nil {
+		defer file.Close()
+		avatar = file
 	}
 
 	// Validate request payload
@@ -72,12 +65,24 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call the service to register the user
-	if err := services.RegisterUser(req); err != nil {
+	if err := services.RegisterUser(req, avatar); err != nil {
 		if errors.Is(err, services.ErrEmailInUse) {
 			log.Println("Email already in use")
 			http.Error(w, "Email already in use", http.StatusConflict)
 			return
 		}
+		if errors.Is(err, services.ErrInvalidHandle) || errors.Is(err, services.ErrReservedHandle) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, services.ErrHandleTaken) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, services.ErrMediaTooLarge) || errors.Is(err, services.ErrUnsupportedMediaType) {
+			writeMediaError(w, err)
+			return
+		}
 		log.Printf("Error registering user: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
@@ -87,27 +92,6 @@ func Register(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "User registered successfully"})
 }
 
-func saveAvatar(file io.Reader) (string, error) {
-	// Example: Save the file to a directory
-	// Generate a unique filename (consider using a UUID or timestamp)
-	filename := fmt.Sprintf("%d_avatar.png", time.Now().UnixNano())
-	path := filepath.Join("uploads", filename) // Adjust path as necessary
-
-	outFile, err := os.Create(path)
-	if err != nil {
-		return "", err
-	}
-	defer outFile.Close()
-
-	// Copy the uploaded file to the destination
-	if _, err := io.Copy(outFile, file); err != nil {
-		return "", err
-	}
-
-	// Return the file path or URL
-	return path, nil
-}
-
 // Login handles user authentication
 func Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
@@ -135,7 +119,7 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Generate a new session ID
-	sessionID, err := middlewares.GenerateSessionID(user.ID)
+	sessionID, err := middlewares.GenerateSessionID(user.ID, r)
 	if err != nil {
 		log.Printf("Error generating session ID: %v", err)
 		http.Error(w, "Error creating session", http.StatusInternalServerError)
@@ -145,9 +129,14 @@ func Login(w http.ResponseWriter, r *http.Request) {
 	// Set the session cookie
 	middlewares.SetSessionCookie(w, sessionID)
 
-	// Respond to the client
+	// Respond to the client. Accounts created before handles existed are sent
+	// to onboarding to pick one with PUT /profile/{id}/handle.
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Login successful",
+		"user_id":      user.ID,
+		"needs_handle": user.Handle == "",
+	})
 }
 
 // GoogleLogin initiates Google OAuth2 login
@@ -180,7 +169,7 @@ func GoogleCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle user login/registration using userInfo
-	handleOAuthUserLogin(w, userInfo, "google")
+	handleOAuthUserLogin(w, r, userInfo, "google")
 }
 
 // FacebookLogin initiates Facebook OAuth2 login
@@ -213,7 +202,7 @@ func FacebookCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle user login/registration using userInfo
-	handleOAuthUserLogin(w, userInfo, "facebook")
+	handleOAuthUserLogin(w, r, userInfo, "facebook")
 }
 
 // GitHubLogin initiates GitHub OAuth2 login
@@ -275,11 +264,11 @@ func GitHubCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Handle user login/registration using userInfo
-	handleOAuthUserLogin(w, map[string]interface{}{"email": primaryEmail}, "github")
+	handleOAuthUserLogin(w, r, map[string]interface{}{"email": primaryEmail}, "github")
 }
 
 // handleOAuthUserLogin processes user info and either logs in or registers the user
-func handleOAuthUserLogin(w http.ResponseWriter, userInfo map[string]interface{}, provider string) {
+func handleOAuthUserLogin(w http.ResponseWriter, r *http.Request, userInfo map[string]interface{}, provider string) {
 	email, ok := userInfo["email"].(string)
 	if !ok {
 		http.Error(w, "Email not found in user info", http.StatusBadRequest)
@@ -295,7 +284,7 @@ func handleOAuthUserLogin(w http.ResponseWriter, userInfo map[string]interface{}
 	}
 
 	// Generate session ID for the authenticated user
-	sessionID, err := middlewares.GenerateSessionID(user.ID)
+	sessionID, err := middlewares.GenerateSessionID(user.ID, r)
 	if err != nil {
 		log.Printf("Error generating session ID: %v", err)
 		http.Error(w, "Error creating session", http.StatusInternalServerError)
@@ -305,7 +294,12 @@ func handleOAuthUserLogin(w http.ResponseWriter, userInfo map[string]interface{}
 	// Set the session cookie
 	middlewares.SetSessionCookie(w, sessionID)
 
-	// Respond to the client
+	// Respond to the client. New OAuth users have no handle yet and are sent
+	// to onboarding to pick one with PUT /profile/{id}/handle.
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Login successful"})
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":      "Login successful",
+		"user_id":      user.ID,
+		"needs_handle": user.Handle == "",
+	})
 }
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"Social/pkg/services"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// authorize checks the authorization policy for the current user. When the
+// action is not allowed it writes the error response and returns false.
+func authorize(w http.ResponseWriter, r *http.Request, action services.Action, resourceID int) (int, bool) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return 0, false
+	}
+
+	if err := services.Authorize(userID, action, resourceID); err != nil {
+		writeAuthorizationError(w, err)
+		return userID, false
+	}
+	return userID, true
+}
+
+// writeAuthorizationError maps errors from services.Authorize to responses
+func writeAuthorizationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	default:
+		log.Printf("Authorization check failed: %v", err)
+		http.Error(w, "Failed to check permissions", http.StatusInternalServerError)
+	}
+}
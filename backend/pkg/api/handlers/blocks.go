@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"Social/pkg/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeBlockError maps block service errors to responses
+func writeBlockError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrNotBlocked):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrBlockSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// GetBlockedUsers handles GET requests for the users the current user blocked
+func GetBlockedUsers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	users, err := services.ListBlockedUsers(userID)
+	if err != nil {
+		writeBlockError(w, err, "Failed to retrieve blocked users")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(users); err != nil {
+		http.Error(w, "Failed to encode blocked users: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// BlockUser handles POST requests to block the user in the URL
+func BlockUser(w http.ResponseWriter, r *http.Request, userIDStr string) {
+	currentUserID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.BlockUser(currentUserID, userID); err != nil {
+		writeBlockError(w, err, "Failed to block user")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User blocked successfully",
+	})
+}
+
+// UnblockUser handles DELETE requests to unblock the user in the URL
+func UnblockUser(w http.ResponseWriter, r *http.Request, userIDStr string) {
+	currentUserID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.UnblockUser(currentUserID, userID); err != nil {
+		writeBlockError(w, err, "Failed to unblock user")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User unblocked successfully",
+	})
+}
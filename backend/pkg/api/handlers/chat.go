@@ -4,6 +4,7 @@ import (
 	"Social/pkg/models"
 	"Social/pkg/services"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -32,7 +33,15 @@ func SendMessage(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("Processed message for storage: %+v", message)
 
-	if err := services.SendMessage(message); err != nil {
+	if _, err := services.SendMessage(message); err != nil {
+		if errors.Is(err, services.ErrUserBlocked) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMedia) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to send message: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -64,6 +73,10 @@ func GetMessages(w http.ResponseWriter, r *http.Request, recipientIDStr string,
 			http.Error(w, "Invalid group ID", http.StatusBadRequest)
 			return
 		}
+		// Only members read the chat of a group
+		if _, ok := authorize(w, r, services.ActionViewGroupChat, groupID); !ok {
+			return
+		}
 	}
 
 	messages, err := services.GetMessages(userID, recipientID, groupID)
@@ -4,11 +4,60 @@ import (
 	"Social/pkg/models"
 	"Social/pkg/services"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 )
 
-// CreateFollowRequest handles POST requests to create a follow request
+// writeFollowError maps follow service errors to responses
+func writeFollowError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrFollowRequestNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrFollowSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrUserBlocked):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrAlreadyFollowing), errors.Is(err, services.ErrFollowRequestPending),
+		errors.Is(err, services.ErrNotFollowing), errors.Is(err, services.ErrFollowRequestNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// follow makes the current user follow userID and writes the outcome
+func follow(w http.ResponseWriter, r *http.Request, userID int) {
+	currentUserID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	request, err := services.Follow(currentUserID, userID)
+	if err != nil {
+		writeFollowError(w, err, "Failed to follow user")
+		return
+	}
+
+	message := "User followed successfully"
+	if request.Status == models.FollowRequestPending {
+		NotifyFollowRequest(request.SenderID, request.RecipientID)
+		message = "Follow request sent successfully"
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    message,
+		"status":     request.Status,
+		"request_id": request.ID,
+	})
+}
+
+// CreateFollowRequest handles POST requests to follow the user given as recipient_id.
+// Public accounts are followed right away, private ones receive a follow request.
 func CreateFollowRequest(w http.ResponseWriter, r *http.Request) {
 	var request models.FollowRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -16,22 +65,67 @@ func CreateFollowRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(int)
+	follow(w, r, request.RecipientID)
+}
+
+// FollowUser handles POST requests to follow the user in the URL
+func FollowUser(w http.ResponseWriter, r *http.Request, userIDStr string) {
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	follow(w, r, userID)
+}
+
+// UnfollowUser handles DELETE requests to stop following the user in the URL
+func UnfollowUser(w http.ResponseWriter, r *http.Request, userIDStr string) {
+	currentUserID, ok := r.Context().Value("userID").(int)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	request.SenderID = userID
-	request.Status = models.FollowRequestPending
 
-	if err := services.CreateFollowRequest(request); err != nil {
-		http.Error(w, "Failed to create follow request: "+err.Error(), http.StatusInternalServerError)
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	if err := services.Unfollow(currentUserID, userID); err != nil {
+		writeFollowError(w, err, "Failed to unfollow user")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "User unfollowed successfully",
+	})
+}
+
+// RemoveFollower handles DELETE requests to remove one of the current user's followers
+func RemoveFollower(w http.ResponseWriter, r *http.Request, followerIDStr string) {
+	currentUserID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	followerID, err := strconv.Atoi(followerIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.RemoveFollower(currentUserID, followerID); err != nil {
+		writeFollowError(w, err, "Failed to remove follower")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Follow request created successfully",
+		"message": "Follower removed successfully",
 	})
 }
 
@@ -43,6 +137,10 @@ func GetFollowRequest(w http.ResponseWriter, r *http.Request, idStr string) {
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionViewFollowRequest, id); !ok {
+		return
+	}
+
 	followRequest, err := services.GetFollowRequest(id)
 	if err != nil {
 		http.Error(w, "Follow request not found: "+err.Error(), http.StatusNotFound)
@@ -56,7 +154,37 @@ func GetFollowRequest(w http.ResponseWriter, r *http.Request, idStr string) {
 	}
 }
 
-// UpdateFollowRequest handles PUT requests to update a follow request
+// GetIncomingFollowRequests handles GET requests for the pending requests sent to the current user
+func GetIncomingFollowRequests(w http.ResponseWriter, r *http.Request) {
+	listFollowRequests(w, r, services.ListIncomingFollowRequests)
+}
+
+// GetOutgoingFollowRequests handles GET requests for the pending requests sent by the current user
+func GetOutgoingFollowRequests(w http.ResponseWriter, r *http.Request) {
+	listFollowRequests(w, r, services.ListOutgoingFollowRequests)
+}
+
+func listFollowRequests(w http.ResponseWriter, r *http.Request, list func(int) ([]models.FollowRequest, error)) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	requests, err := list(userID)
+	if err != nil {
+		log.Printf("Failed to list follow requests for user %d: %v", userID, err)
+		http.Error(w, "Failed to retrieve follow requests", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(requests); err != nil {
+		http.Error(w, "Failed to encode follow requests: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// UpdateFollowRequest handles PUT requests to accept or reject a follow request
 func UpdateFollowRequest(w http.ResponseWriter, r *http.Request, idStr string) {
 	var request models.FollowRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -70,18 +198,29 @@ func UpdateFollowRequest(w http.ResponseWriter, r *http.Request, idStr string) {
 		return
 	}
 
-	if err := services.UpdateFollowRequest(id, request.Status); err != nil {
-		http.Error(w, "Failed to update follow request: "+err.Error(), http.StatusInternalServerError)
+	// Only the recipient may answer a follow request
+	if _, ok := authorize(w, r, services.ActionRespondToFollowRequest, id); !ok {
+		return
+	}
+
+	switch request.Status {
+	case models.FollowRequestAccepted:
+		_, err = services.AcceptFollowRequest(id)
+	case models.FollowRequestRejected:
+		_, err = services.RejectFollowRequest(id)
+	default:
+		http.Error(w, "Status must be accepted or rejected", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeFollowError(w, err, "Failed to update follow request")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Follow request updated successfully",
-	})
 }
 
-// DeleteFollowRequest handles DELETE requests to delete a follow request
+// DeleteFollowRequest handles DELETE requests to cancel a pending follow request
 func DeleteFollowRequest(w http.ResponseWriter, r *http.Request, idStr string) {
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -89,15 +228,17 @@ func DeleteFollowRequest(w http.ResponseWriter, r *http.Request, idStr string) {
 		return
 	}
 
-	if err := services.DeleteFollowRequest(id); err != nil {
-		http.Error(w, "Failed to delete follow request: "+err.Error(), http.StatusInternalServerError)
+	// Only the sender may cancel their request
+	if _, ok := authorize(w, r, services.ActionCancelFollowRequest, id); !ok {
+		return
+	}
+
+	if err := services.CancelFollowRequest(id); err != nil {
+		writeFollowError(w, err, "Failed to cancel follow request")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Follow request deleted successfully",
-	})
 }
 
 // AcceptFollowRequest handles POST requests to accept a follow request
@@ -109,29 +250,17 @@ func AcceptFollowRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update the follow request status to accepted
-	if err := services.UpdateFollowRequest(id, models.FollowRequestAccepted); err != nil {
-		http.Error(w, "Failed to accept follow request: "+err.Error(), http.StatusInternalServerError)
+	if _, ok := authorize(w, r, services.ActionRespondToFollowRequest, id); !ok {
 		return
 	}
 
-	// Retrieve the follow request
-	followRequest, err := services.GetFollowRequest(id)
-	if err != nil {
-		http.Error(w, "Failed to retrieve follow request: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Add recipient to sender's followers list
-	if err := services.AddFollower(followRequest.SenderID, followRequest.RecipientID); err != nil {
-		http.Error(w, "Failed to add follower: "+err.Error(), http.StatusInternalServerError)
+	// Accept the request and add the sender to the recipient's followers
+	if _, err := services.AcceptFollowRequest(id); err != nil {
+		writeFollowError(w, err, "Failed to accept follow request")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Follow request accepted and follower added successfully",
-	})
 }
 
 // RejectFollowRequest handles POST requests to reject a follow request
@@ -143,14 +272,15 @@ func RejectFollowRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionRespondToFollowRequest, id); !ok {
+		return
+	}
+
 	// Update the follow request status to rejected
-	if err := services.UpdateFollowRequest(id, models.FollowRequestRejected); err != nil {
-		http.Error(w, "Failed to reject follow request: "+err.Error(), http.StatusInternalServerError)
+	if _, err := services.RejectFollowRequest(id); err != nil {
+		writeFollowError(w, err, "Failed to reject follow request")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Follow request rejected successfully",
-	})
 }
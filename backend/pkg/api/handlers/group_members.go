@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"Social/pkg/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// writeGroupError maps group service errors to responses
+func writeGroupError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrForbidden), errors.Is(err, services.ErrUserBlocked),
+		errors.Is(err, services.ErrGroupRequiresRequest), errors.Is(err, services.ErrGroupInviteOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrNotFound), errors.Is(err, services.ErrUserNotFound),
+		errors.Is(err, services.ErrNotGroupMember):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidGroupRole), errors.Is(err, services.ErrCannotChangeOwnRole),
+		errors.Is(err, services.ErrInviteSelf), errors.Is(err, services.ErrInvalidGroupStatus),
+		errors.Is(err, services.ErrEmptyGroupTitle), errors.Is(err, services.ErrInvalidGroupVisibility),
+		errors.Is(err, services.ErrInvalidGroupSort),
+		errors.Is(err, services.ErrEmptySearchQuery), errors.Is(err, services.ErrInvalidCursor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, services.ErrOwnerMustTransfer), errors.Is(err, services.ErrAlreadyGroupMember),
+		errors.Is(err, services.ErrGroupInvitationPending), errors.Is(err, services.ErrGroupRequestPending),
+		errors.Is(err, services.ErrGroupEntryNotPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// GetGroupMembers handles GET requests to list the members of a group and their roles
+func GetGroupMembers(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorize(w, r, services.ActionViewGroupMembers, groupID); !ok {
+		return
+	}
+
+	members, err := services.ListGroupMembers(groupID)
+	if err != nil {
+		log.Printf("Failed to list members of group %d: %v", groupID, err)
+		http.Error(w, "Failed to retrieve group members", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		http.Error(w, "Failed to encode group members: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// UpdateGroupMemberRole handles PUT requests to promote or demote a member of a group
+func UpdateGroupMemberRole(w http.ResponseWriter, r *http.Request, groupIDStr, userIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := authorize(w, r, services.ActionManageGroupRoles, groupID)
+	if !ok {
+		return
+	}
+
+	if err := services.SetMemberRole(userID, groupID, memberID, request.Role); err != nil {
+		writeGroupError(w, err, "Failed to update member role")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveGroupMember handles DELETE requests to remove a member from a group
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request, groupIDStr, userIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	memberID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := authorize(w, r, services.ActionRemoveGroupMember, groupID)
+	if !ok {
+		return
+	}
+
+	if err := services.RemoveGroupMember(userID, groupID, memberID); err != nil {
+		writeGroupError(w, err, "Failed to remove group member")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TransferGroupOwnership handles POST requests from the owner to hand the group over to another member
+func TransferGroupOwnership(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var request struct {
+		UserID int `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := authorize(w, r, services.ActionTransferGroup, groupID)
+	if !ok {
+		return
+	}
+
+	if err := services.TransferGroupOwnership(userID, groupID, request.UserID); err != nil {
+		writeGroupError(w, err, "Failed to transfer group ownership")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -4,6 +4,8 @@ import (
 	"Social/pkg/models"
 	"Social/pkg/services"
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,16 +13,23 @@ import (
 
 // CreateGroup handles POST requests to create a new group
 func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	var group models.Group
 	err := json.NewDecoder(r.Body).Decode(&group)
 	if err != nil {
 		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	group.CreatorID = userID
 
 	groupID, err := services.CreateGroup(group)
 	if err != nil {
-		http.Error(w, "Failed to create group: "+err.Error(), http.StatusInternalServerError)
+		writeGroupError(w, err, "Failed to create group")
 		return
 	}
 
@@ -39,75 +48,227 @@ func GetGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Secret groups are only shown to their members and invitees
+	if _, ok := authorize(w, r, services.ActionViewGroup, groupID); !ok {
+		return
+	}
+
 	group, err := services.GetGroup(groupID)
 	if err != nil {
-		http.Error(w, "Group not found: "+err.Error(), http.StatusNotFound)
+		writeGroupError(w, err, "Failed to retrieve group")
 		return
 	}
 
 	json.NewEncoder(w).Encode(group)
 }
 
-// ListGroups handles GET requests to list groups with optional filtering
+// ListGroups handles GET requests for a page of the group directory.
+// Query parameters: q, sort (members or activity), cursor and limit.
 func ListGroups(w http.ResponseWriter, r *http.Request) {
-	offset := r.URL.Query().Get("offset")
-	limit := r.URL.Query().Get("limit")
-	searchTerm := r.URL.Query().Get("search")
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
 
-	offsetInt, _ := strconv.Atoi(offset)
-	limitInt, _ := strconv.Atoi(limit)
+	page, err := services.ListGroups(userID, query.Get("q"), query.Get("sort"), query.Get("cursor"), limit)
+	if err != nil {
+		writeGroupError(w, err, "Failed to retrieve groups")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "Failed to encode groups: "+err.Error(), http.StatusInternalServerError)
+	}
+}
 
-	groups, err := services.ListGroups(offsetInt, limitInt, searchTerm)
+// UpdateGroup handles PUT requests to change the title and description of a group
+func UpdateGroup(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
 	if err != nil {
-		http.Error(w, "Failed to retrieve groups: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var group models.Group
+	if err := json.NewDecoder(r.Body).Decode(&group); err != nil {
+		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only the owner may edit the group
+	if _, ok := authorize(w, r, services.ActionEditGroup, groupID); !ok {
+		return
+	}
+
+	updated, err := services.UpdateGroup(groupID, group)
+	if err != nil {
+		writeGroupError(w, err, "Failed to update group")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(updated); err != nil {
+		http.Error(w, "Failed to encode group: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// DeleteGroup handles DELETE requests to delete a group along with its
+// memberships, invitations, requests, events and chat
+func DeleteGroup(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	// Only the owner may delete the group
+	if _, ok := authorize(w, r, services.ActionDeleteGroup, groupID); !ok {
 		return
 	}
 
-	json.NewEncoder(w).Encode(groups)
+	if err := services.DeleteGroup(groupID); err != nil {
+		writeGroupError(w, err, "Failed to delete group")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// InviteToGroup handles POST requests to invite a user to a group
-func InviteToGroup(w http.ResponseWriter, r *http.Request) {
+// InviteToGroup handles POST requests to invite the user given as invitee_id to a group
+func InviteToGroup(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
 	var invitation models.GroupInvitation
-	err := json.NewDecoder(r.Body).Decode(&invitation)
+	err = json.NewDecoder(r.Body).Decode(&invitation)
 	if err != nil {
 		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = services.InviteToGroup(invitation)
+	// Only members whose role allows it can invite other users to their group
+	userID, ok := authorize(w, r, services.ActionInviteToGroup, groupID)
+	if !ok {
+		return
+	}
+	invitation.GroupID = groupID
+	invitation.InviterID = userID
+
+	invitationID, err := services.InviteToGroup(invitation)
 	if err != nil {
-		http.Error(w, "Failed to invite user to group: "+err.Error(), http.StatusInternalServerError)
+		writeGroupError(w, err, "Failed to invite user to group")
 		return
 	}
 
+	NotifyGroupInvite(userID, invitation.InviteeID, groupID)
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "User invited to group successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":       "User invited to group successfully",
+		"invitation_id": invitationID,
 	})
 }
 
-// CreateGroupRequest handles POST requests to create a group request
-func CreateGroupRequest(w http.ResponseWriter, r *http.Request) {
-	var request models.GroupRequest
-	err := json.NewDecoder(r.Body).Decode(&request)
+// GetGroupInvitations handles GET requests for the pending group invitations of the current user
+func GetGroupInvitations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	invitations, err := services.ListGroupInvitations(userID)
 	if err != nil {
-		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+		writeGroupError(w, err, "Failed to retrieve group invitations")
 		return
 	}
 
-	err = services.CreateGroupRequest(request)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(invitations); err != nil {
+		http.Error(w, "Failed to encode group invitations: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateGroupRequest handles POST requests from the current user to join a group
+func CreateGroupRequest(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
 	if err != nil {
-		http.Error(w, "Failed to create group request: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
 		return
 	}
 
+	userID, ok := authorize(w, r, services.ActionJoinGroup, groupID)
+	if !ok {
+		return
+	}
+
+	requestID, err := services.CreateGroupRequest(models.GroupRequest{GroupID: groupID, RequesterID: userID})
+	if err != nil {
+		writeGroupError(w, err, "Failed to create group request")
+		return
+	}
+
+	// Everyone who may approve the request is told about it
+	approverIDs, err := services.GetGroupMemberIDsWithPermission(groupID, services.PermApproveRequests)
+	if err != nil {
+		log.Printf("Failed to look up approvers of group %d: %v", groupID, err)
+	}
+	for _, approverID := range approverIDs {
+		NotifyGroupJoinRequest(approverID, userID, groupID)
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Group request created successfully",
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    "Group request created successfully",
+		"request_id": requestID,
 	})
 }
 
+// GetGroupRequests handles GET requests for the pending requests to join a group
+func GetGroupRequests(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	// Only the members who may answer the requests can see them
+	if _, ok := authorize(w, r, services.ActionViewGroupRequests, groupID); !ok {
+		return
+	}
+
+	requests, err := services.ListGroupRequests(groupID)
+	if err != nil {
+		writeGroupError(w, err, "Failed to retrieve group requests")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(requests); err != nil {
+		http.Error(w, "Failed to encode group requests: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
 // CreateGroupEvent handles POST requests to create a group event
 func CreateGroupEvent(w http.ResponseWriter, r *http.Request) {
 	var event models.GroupEvent
@@ -117,6 +278,10 @@ func CreateGroupEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionCreateGroupEvent, event.GroupID); !ok {
+		return
+	}
+
 	err = services.CreateGroupEvent(event)
 	if err != nil {
 		http.Error(w, "Failed to create group event: "+err.Error(), http.StatusInternalServerError)
@@ -138,6 +303,12 @@ func RSVPEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID, ok := authorize(w, r, services.ActionRespondToEvent, rsvp.EventID)
+	if !ok {
+		return
+	}
+	rsvp.UserID = userID
+
 	err = services.RSVPEvent(rsvp)
 	if err != nil {
 		http.Error(w, "Failed to RSVP to event: "+err.Error(), http.StatusInternalServerError)
@@ -170,6 +341,11 @@ func GetGroupEvent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The events of private and secret groups are for their members only
+	if _, ok := authorize(w, r, services.ActionViewGroupContent, groupID); !ok {
+		return
+	}
+
 	event, err := services.GetGroupEvent(groupID, eventID)
 	if err != nil {
 		http.Error(w, "Event not found: "+err.Error(), http.StatusNotFound)
@@ -195,18 +371,15 @@ func JoinGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var requestBody struct {
-		UserID int `json:"user_id"`
-	}
-	err = json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+	// The joining user is always the one of the session
+	userID, ok := authorize(w, r, services.ActionJoinGroup, groupID)
+	if !ok {
 		return
 	}
 
-	err = services.JoinGroup(groupID, requestBody.UserID)
+	err = services.JoinGroup(groupID, userID)
 	if err != nil {
-		http.Error(w, "Failed to join group: "+err.Error(), http.StatusInternalServerError)
+		writeGroupError(w, err, "Failed to join group")
 		return
 	}
 
@@ -232,18 +405,16 @@ func LeaveGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var requestBody struct {
-		UserID int `json:"user_id"`
-	}
-	err = json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid input: "+err.Error(), http.StatusBadRequest)
+	// The leaving user is always the one of the session
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	err = services.LeaveGroup(groupID, requestBody.UserID)
+	err = services.LeaveGroup(groupID, userID)
 	if err != nil {
-		http.Error(w, "Failed to leave group: "+err.Error(), http.StatusInternalServerError)
+		writeGroupError(w, err, "Failed to leave group")
 		return
 	}
 
@@ -264,12 +435,19 @@ func RespondToInvitation(w http.ResponseWriter, r *http.Request, invitationID in
 		return
 	}
 
-	err = services.RespondToInvitation(invitationID, response.Status)
+	// Only the invited user may answer an invitation
+	if _, ok := authorize(w, r, services.ActionRespondToInvitation, invitationID); !ok {
+		return
+	}
+
+	invitation, err := services.RespondToInvitation(invitationID, response.Status)
 	if err != nil {
-		http.Error(w, "Failed to respond to invitation: "+err.Error(), http.StatusInternalServerError)
+		writeGroupError(w, err, "Failed to respond to invitation")
 		return
 	}
 
+	NotifyGroupInviteResponse(invitation)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Invitation response recorded successfully",
@@ -287,14 +465,102 @@ func RespondToGroupRequest(w http.ResponseWriter, r *http.Request, requestID int
 		return
 	}
 
-	err = services.RespondToGroupRequest(requestID, response.Status)
+	// Only moderators and above may answer requests to join the group
+	if _, ok := authorize(w, r, services.ActionRespondToGroupRequest, requestID); !ok {
+		return
+	}
+
+	request, err := services.RespondToGroupRequest(requestID, response.Status)
 	if err != nil {
-		http.Error(w, "Failed to respond to group request: "+err.Error(), http.StatusInternalServerError)
+		writeGroupError(w, err, "Failed to respond to group request")
 		return
 	}
 
+	NotifyGroupJoinRequestResponse(request)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message": "Group request response recorded successfully",
 	})
 }
+
+// CreateGroupPost handles POST requests from a member to share a post in a
+// group, with a multipart form holding its content and optional image
+func CreateGroupPost(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := authorize(w, r, services.ActionPostToGroup, groupID)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequestSize())
+	r.ParseMultipartForm(10 << 20)
+
+	// The image is optional, as on personal posts
+	mediaID, ok := formMedia(w, r, userID, "image")
+	if !ok {
+		return
+	}
+
+	post := models.Post{
+		UserID:  userID,
+		GroupID: &groupID,
+		Content: r.FormValue("content"),
+		MediaID: mediaID,
+	}
+	postID, err := services.CreatePost(post, nil, nil)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidMedia) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeGroupError(w, err, "Failed to create group post")
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Post created successfully",
+		"post_id": postID,
+	})
+}
+
+// GetGroupPosts handles GET requests for a page of the posts shared in a
+// group. Query parameters: cursor and limit.
+func GetGroupPosts(w http.ResponseWriter, r *http.Request, groupIDStr string) {
+	groupID, err := strconv.Atoi(groupIDStr)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	// The posts of private and secret groups are for their members only
+	userID, ok := authorize(w, r, services.ActionViewGroupContent, groupID)
+	if !ok {
+		return
+	}
+
+	limit := 0
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := services.GetGroupFeed(userID, groupID, r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		writeGroupError(w, err, "Failed to retrieve group posts")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "Failed to encode group posts: "+err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"Social/pkg/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxUploadRequestSize is the largest request accepted for an upload: the
+// largest file plus room for the other fields of the form
+func maxUploadRequestSize() int64 {
+	return services.MaxMediaSize() + 1<<20
+}
+
+// writeMediaError maps media service errors to responses
+func writeMediaError(w http.ResponseWriter, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, services.ErrMediaTooLarge), errors.As(err, &maxBytesErr):
+		http.Error(w, services.ErrMediaTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, services.ErrUnsupportedMediaType):
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+	case errors.Is(err, services.ErrInvalidMedia):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Failed to store media: %v", err)
+		http.Error(w, "Failed to store media", http.StatusInternalServerError)
+	}
+}
+
+// UploadMedia handles POST requests uploading a file in the "file" field of a
+// multipart form. The returned media ID can then be attached to a post, a
+// comment, an avatar or a chat message.
+func UploadMedia(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequestSize())
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeMediaError(w, err)
+			return
+		}
+		http.Error(w, "Unable to retrieve the file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	media, err := services.UploadMedia(userID, file)
+	if err != nil {
+		writeMediaError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(media)
+}
+
+// formMedia returns the media attached to a multipart form: a file uploaded
+// in field, stored on the fly, or the ID of an earlier upload in "media_id".
+// It returns nil when neither is set, and writes the error response itself
+// when ok is false.
+func formMedia(w http.ResponseWriter, r *http.Request, userID int, field string) (mediaID *int, ok bool) {
+	file, _, err := r.FormFile(field)
+	if err == nil {
+		defer file.Close()
+		media, err := services.UploadMedia(userID, file)
+		if err != nil {
+			writeMediaError(w, err)
+			return nil, false
+		}
+		return &media.ID, true
+	}
+	if err != http.ErrMissingFile {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeMediaError(w, err)
+			return nil, false
+		}
+		http.Error(w, "Unable to retrieve the file", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if idStr := r.FormValue("media_id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			http.Error(w, "Invalid media ID", http.StatusBadRequest)
+			return nil, false
+		}
+		return &id, true
+	}
+	return nil, true
+}
+
+// mediaCacheMaxAge is how long browsers may reuse a media served to a
+// session. It is kept short as access to a media can be revoked, for
+// instance when its post is made private.
+const mediaCacheMaxAge = time.Hour
+
+// ServeMedia handles GET requests for a variant of a media with the session
+// of a user allowed to see it: thumb, feed or full, full by default
+func ServeMedia(w http.ResponseWriter, r *http.Request, mediaIDStr, variant string) {
+	mediaID, err := strconv.Atoi(mediaIDStr)
+	if err != nil {
+		http.Error(w, "Invalid media ID", http.StatusBadRequest)
+		return
+	}
+	if _, ok := authorize(w, r, services.ActionViewMedia, mediaID); !ok {
+		return
+	}
+	serveMediaFile(w, r, mediaID, variant, mediaCacheMaxAge)
+}
+
+// ServeSignedMedia handles GET requests for a variant of a media through a
+// signed URL, which grants access on its own until it expires
+func ServeSignedMedia(w http.ResponseWriter, r *http.Request, mediaIDStr, variant string) {
+	mediaID, err := strconv.Atoi(mediaIDStr)
+	if err != nil {
+		http.Error(w, "Invalid media ID", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	expires, err := services.VerifyMediaSignature(mediaID, variant, query.Get("expires"), query.Get("sig"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	serveMediaFile(w, r, mediaID, variant, time.Until(expires))
+}
+
+// serveMediaFile streams a variant of a media, answering range and
+// conditional requests, and lets browsers cache it for at most maxAge
+func serveMediaFile(w http.ResponseWriter, r *http.Request, mediaID int, variant string, maxAge time.Duration) {
+	file, err := services.OpenMedia(mediaID, variant)
+	if err != nil {
+		if errors.Is(err, services.ErrMediaNotFound) {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to open media %d: %v", mediaID, err)
+		http.Error(w, "Failed to retrieve media", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", file.ContentType)
+	header.Set("ETag", file.ETag)
+	header.Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(maxAge.Seconds())))
+	header.Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", file.ModTime, file)
+}
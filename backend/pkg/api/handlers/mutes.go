@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"Social/pkg/models"
+	"Social/pkg/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeMuteError maps mute service errors to responses
+func writeMuteError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound), errors.Is(err, services.ErrNotFound),
+		errors.Is(err, services.ErrMuteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrInvalidMuteTarget), errors.Is(err, services.ErrInvalidKeyword),
+		errors.Is(err, services.ErrInvalidDuration), errors.Is(err, services.ErrMuteSelf):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
+// parseMuteDuration reads durations such as "30m", "8h" or "7d". An empty
+// duration mutes until the mute is removed.
+func parseMuteDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, services.ErrInvalidDuration
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, services.ErrInvalidDuration
+	}
+	return duration, nil
+}
+
+// GetMutes handles GET requests for the active mutes of the current user
+func GetMutes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	mutes, err := services.ListMutes(userID)
+	if err != nil {
+		writeMuteError(w, err, "Failed to retrieve mutes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(mutes); err != nil {
+		http.Error(w, "Failed to encode mutes: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// CreateMute handles POST requests to mute a user, a group or a keyword.
+// The body holds target_type, target_id or keyword, and an optional duration.
+func CreateMute(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		models.Mute
+		Duration string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	duration, err := parseMuteDuration(body.Duration)
+	if err != nil {
+		writeMuteError(w, err, "Failed to mute")
+		return
+	}
+
+	mute, err := services.MuteTarget(userID, body.Mute, duration)
+	if err != nil {
+		writeMuteError(w, err, "Failed to mute")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mute)
+}
+
+// DeleteMute handles DELETE requests to remove one of the current user's mutes
+func DeleteMute(w http.ResponseWriter, r *http.Request, muteIDStr string) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	muteID, err := strconv.Atoi(muteIDStr)
+	if err != nil {
+		http.Error(w, "Invalid mute ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := services.Unmute(userID, muteID); err != nil {
+		writeMuteError(w, err, "Failed to remove mute")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -41,6 +41,11 @@ func CreateNotification(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients may only create notifications for themselves
+	if _, ok := authorize(w, r, services.ActionCreateNotification, notification.UserID); !ok {
+		return
+	}
+
 	if err := services.CreateNotification(notification); err != nil {
 		log.Printf("Failed to create notification: %v", err)
 		http.Error(w, "Failed to create notification", http.StatusInternalServerError)
@@ -98,6 +103,38 @@ func NotifyGroupJoinRequest(groupCreatorID, requesterID, groupID int) {
 	}
 }
 
+// NotifyGroupInviteResponse tells the inviter whether their invitation was accepted
+func NotifyGroupInviteResponse(invitation models.GroupInvitation) {
+	message := fmt.Sprintf("Your group invitation was %s.", invitation.Status)
+	notification := models.Notification{
+		UserID:    invitation.InviterID,
+		Type:      "group_invite_response",
+		Message:   message,
+		IsRead:    false,
+		CreatedAt: time.Now(),
+		Details:   fmt.Sprintf("group_id:%d, invitee_id:%d, status:%s", invitation.GroupID, invitation.InviteeID, invitation.Status),
+	}
+	if err := services.CreateNotification(notification); err != nil {
+		log.Printf("Failed to send group invite response notification: %v", err)
+	}
+}
+
+// NotifyGroupJoinRequestResponse tells the requester whether they were let into the group
+func NotifyGroupJoinRequestResponse(request models.GroupRequest) {
+	message := fmt.Sprintf("Your request to join a group was %s.", request.Status)
+	notification := models.Notification{
+		UserID:    request.RequesterID,
+		Type:      "group_join_request_response",
+		Message:   message,
+		IsRead:    false,
+		CreatedAt: time.Now(),
+		Details:   fmt.Sprintf("group_id:%d, status:%s", request.GroupID, request.Status),
+	}
+	if err := services.CreateNotification(notification); err != nil {
+		log.Printf("Failed to send group join request response notification: %v", err)
+	}
+}
+
 // NotifyEventCreation sends a notification when an event is created in a group
 func NotifyEventCreation(groupID, eventID int) {
 	message := "An event has been created in your group."
@@ -128,6 +165,10 @@ func MarkNotificationAsRead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionMarkNotificationRead, notificationID); !ok {
+		return
+	}
+
 	if err := services.MarkNotificationAsRead(notificationID); err != nil {
 		log.Printf("Failed to mark notification %d as read: %v", notificationID, err)
 		http.Error(w, "Failed to mark notification as read", http.StatusInternalServerError)
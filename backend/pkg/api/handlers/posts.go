@@ -4,62 +4,51 @@ import (
 	"Social/pkg/models"
 	"Social/pkg/services"
 	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 )
 
 func CreatePost(w http.ResponseWriter, r *http.Request) {
-	r.ParseMultipartForm(10 << 20) // Limit your max memory size
-
 	// Retrieve the userID from context (set by middleware)
 	userID, ok := r.Context().Value("userID").(int)
 	if !ok {
 		http.Error(w, "Unauthorized: User ID not found", http.StatusUnauthorized)
 		return
 	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadRequestSize())
+	r.ParseMultipartForm(10 << 20) // Limit your max memory size
 	log.Printf("Received userID from context: %d", userID)
 
 	// Retrieve form fields
 	content := r.FormValue("content")
 	privacy := r.FormValue("privacy")
+	if privacy == "" {
+		privacy = models.PrivacyPublic
+	}
 
-	// Retrieve the file from the form-data
-	file, handler, err := r.FormFile("image")
+	// Followers chosen to see an almost private post, sent as repeated
+	// "audience" fields or as a comma separated list
+	audienceIDs, err := parseIDList(r.Form["audience"])
 	if err != nil {
-		http.Error(w, "Unable to retrieve the file", http.StatusBadRequest)
+		http.Error(w, "Invalid audience", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
-
-	// Define the path to save the file
-	uploadDir := "../../uploads"
-	filePath := fmt.Sprintf("%s/%s", uploadDir, handler.Filename)
-
-	// Ensure the upload directory exists
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		err := os.MkdirAll(uploadDir, os.ModePerm)
-		if err != nil {
-			http.Error(w, "Unable to create upload directory", http.StatusInternalServerError)
-			return
-		}
-	}
-
-	// Create a file in the defined path
-	outFile, err := os.Create(filePath)
+	// Audience lists of the author the post is shared with, sent the same way
+	// as "audience_lists" fields
+	listIDs, err := parseIDList(r.Form["audience_lists"])
 	if err != nil {
-		http.Error(w, "Unable to save the file", http.StatusInternalServerError)
+		http.Error(w, "Invalid audience lists", http.StatusBadRequest)
 		return
 	}
-	defer outFile.Close()
 
-	// Copy the file content to the destination file
-	_, err = io.Copy(outFile, file)
-	if err != nil {
-		http.Error(w, "Unable to save the file", http.StatusInternalServerError)
+	// The image is optional: either uploaded with the post or uploaded
+	// beforehand through /media and referenced by media_id
+	mediaID, ok := formMedia(w, r, userID, "image")
+	if !ok {
 		return
 	}
 
@@ -67,13 +56,18 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 	post := models.Post{
 		UserID:  userID,
 		Content: content,
-		Image:   filePath, // Store the image path
+		MediaID: mediaID,
 		Privacy: privacy,
 	}
 
 	// Pass the post to the service layer for database insertion
-	err = services.CreatePost(post)
+	_, err = services.CreatePost(post, audienceIDs, listIDs)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidPrivacy) || errors.Is(err, services.ErrInvalidAudience) ||
+			errors.Is(err, services.ErrInvalidMedia) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		log.Printf("Failed to create post: %v", err)
 		http.Error(w, "Failed to create post", http.StatusInternalServerError)
 		return
@@ -86,15 +80,25 @@ func CreatePost(w http.ResponseWriter, r *http.Request) {
 
 // GetPost handles GET requests to retrieve a specific post
 func GetPost(w http.ResponseWriter, r *http.Request, postIDStr string) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
 		http.Error(w, "Invalid post ID", http.StatusBadRequest)
 		return
 	}
 
-	post, err := services.GetPost(postID)
+	post, err := services.GetPost(userID, postID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusNotFound)
+		if errors.Is(err, services.ErrPostNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to retrieve post", http.StatusInternalServerError)
 		return
 	}
 
@@ -106,8 +110,14 @@ func GetPost(w http.ResponseWriter, r *http.Request, postIDStr string) {
 
 // GetAllPosts handles retrieving all posts
 func GetAllPosts(w http.ResponseWriter, r *http.Request) {
-	// Retrieve all posts from the service layer
-	posts, err := services.GetAllPosts()
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Retrieve the posts visible to the current user from the service layer
+	posts, err := services.GetAllPosts(userID)
 	if err != nil {
 		http.Error(w, "Failed to retrieve posts", http.StatusInternalServerError)
 		return
@@ -122,8 +132,14 @@ func GetAllPosts(w http.ResponseWriter, r *http.Request) {
 
 // UpdatePost handles PUT requests to update a post
 func UpdatePost(w http.ResponseWriter, r *http.Request, postIDStr string) {
-	var post models.Post
-	if err := json.NewDecoder(r.Body).Decode(&post); err != nil {
+	// The audience of an almost private post is sent along with it, as in
+	// CreatePost
+	var req struct {
+		models.Post
+		Audience      []int `json:"audience"`
+		AudienceLists []int `json:"audience_lists"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -134,8 +150,16 @@ func UpdatePost(w http.ResponseWriter, r *http.Request, postIDStr string) {
 		return
 	}
 
-	err = services.UpdatePost(postID, post)
+	if _, ok := authorize(w, r, services.ActionUpdatePost, postID); !ok {
+		return
+	}
+
+	err = services.UpdatePost(postID, req.Post, req.Audience, req.AudienceLists)
 	if err != nil {
+		if errors.Is(err, services.ErrInvalidPrivacy) || errors.Is(err, services.ErrInvalidAudience) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -152,6 +176,10 @@ func DeletePost(w http.ResponseWriter, r *http.Request, postIDStr string) {
 		return
 	}
 
+	if _, ok := authorize(w, r, services.ActionDeletePost, postID); !ok {
+		return
+	}
+
 	err = services.DeletePost(postID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -161,3 +189,23 @@ func DeletePost(w http.ResponseWriter, r *http.Request, postIDStr string) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Delete Post successfully"})
 }
+
+// parseIDList parses IDs given as repeated form values, each of which may
+// also hold a comma separated list
+func parseIDList(values []string) ([]int, error) {
+	var ids []int
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -5,7 +5,9 @@ import (
 	"Social/pkg/services"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 )
 
@@ -24,6 +26,21 @@ func getCurrentUserID(r *http.Request) (int, error) {
 	return userID, nil
 }
 
+// writeProfileError maps profile service errors to responses
+func writeProfileError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrProfileNotFound):
+		http.Error(w, "Profile not found", http.StatusNotFound)
+	case errors.Is(err, services.ErrPrivateProfile):
+		http.Error(w, "Profile is private and you are not a follower", http.StatusForbidden)
+	case errors.Is(err, services.ErrInvalidCursor), errors.Is(err, services.ErrInvalidConnection):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("%s: %v", message, err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
+
 // GetProfile handles retrieving a user's profile information.
 func GetProfile(w http.ResponseWriter, r *http.Request, userIDStr string) {
 	// Parse the requested user ID
@@ -40,31 +57,63 @@ func GetProfile(w http.ResponseWriter, r *http.Request, userIDStr string) {
 		return
 	}
 
-	// Retrieve profile information
-	profile, posts, followers, following, err := services.GetProfile(requesterID, userID)
+	writeProfile(w, requesterID, userID)
+}
+
+// GetProfileByHandle handles GET /u/{handle}, showing the profile a handle
+// points to. Former handles redirect to the current one.
+func GetProfileByHandle(w http.ResponseWriter, r *http.Request, handle string) {
+	requesterID, err := getCurrentUserID(r)
 	if err != nil {
-		switch err.Error() {
-		case "profile not found":
-			http.Error(w, "Profile not found", http.StatusNotFound)
-		case "profile is private and you are not a follower":
-			http.Error(w, "Profile is private and you are not a follower", http.StatusForbidden)
-		default:
-			http.Error(w, "Failed to retrieve profile", http.StatusInternalServerError)
+		http.Error(w, "Unable to retrieve current user ID", http.StatusInternalServerError)
+		return
+	}
+
+	userID, current, redirected, err := services.ResolveHandle(handle)
+	if err != nil {
+		writeProfileError(w, err, "Failed to resolve handle")
+		return
+	}
+	if redirected {
+		// Not permanent: the former handle is released once its redirect expires
+		http.Redirect(w, r, "/u/"+url.PathEscape(current), http.StatusFound)
+		return
+	}
+
+	writeProfile(w, requesterID, userID)
+}
+
+// writeProfile writes the profile of userID as requesterID may see it
+func writeProfile(w http.ResponseWriter, requesterID, userID int) {
+	// Retrieve profile information
+	profile, posts, followerCount, followingCount, err := services.GetProfile(requesterID, userID)
+	if errors.Is(err, services.ErrPrivateProfile) {
+		// Users who do not follow a private profile still get its public card
+		card, err := services.GetProfileCard(requesterID, userID)
+		if err != nil {
+			writeProfileError(w, err, "Failed to retrieve profile")
+			return
 		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(card)
+		return
+	}
+	if err != nil {
+		writeProfileError(w, err, "Failed to retrieve profile")
 		return
 	}
 
 	// Create response structure
 	response := struct {
-		User      models.User   `json:"user"`
-		Posts     []models.Post `json:"posts"`
-		Followers []models.User `json:"followers"`
-		Following []models.User `json:"following"`
+		User           models.User   `json:"user"`
+		Posts          []models.Post `json:"posts"`
+		FollowerCount  int           `json:"follower_count"`
+		FollowingCount int           `json:"following_count"`
 	}{
-		User:      profile,
-		Posts:     posts,
-		Followers: followers,
-		Following: following,
+		User:           profile,
+		Posts:          posts,
+		FollowerCount:  followerCount,
+		FollowingCount: followingCount,
 	}
 
 	// Encode response as JSON
@@ -88,8 +137,17 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request, userIDStr string) {
 		return
 	}
 
+	// Users may only update their own profile
+	if _, ok := authorize(w, r, services.ActionUpdateProfile, userID); !ok {
+		return
+	}
+
 	// Update the profile
 	if err := services.UpdateProfile(userID, user); err != nil {
+		if errors.Is(err, services.ErrInvalidVisibility) || errors.Is(err, services.ErrInvalidMedia) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to update profile: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -97,3 +155,83 @@ func UpdateProfile(w http.ResponseWriter, r *http.Request, userIDStr string) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Profile updated successfully"})
 }
+
+// GetProfileConnections handles GET requests for the followers of a user, the
+// users they follow, or their followers whom the current user follows too.
+// Query parameters: q, cursor and limit.
+func GetProfileConnections(w http.ResponseWriter, r *http.Request, userIDStr, kind string) {
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	requesterID, err := getCurrentUserID(r)
+	if err != nil {
+		http.Error(w, "Unable to retrieve current user ID", http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	page, err := services.ListConnections(requesterID, userID, kind, query.Get("q"), query.Get("cursor"), limit)
+	if err != nil {
+		writeProfileError(w, err, "Failed to retrieve "+kind)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		http.Error(w, "Failed to encode "+kind, http.StatusInternalServerError)
+	}
+}
+
+// UpdateHandle handles PUT requests to pick or change the handle of a user,
+// with a body holding the new handle
+func UpdateHandle(w http.ResponseWriter, r *http.Request, userIDStr string) {
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Users may only change their own handle
+	if _, ok := authorize(w, r, services.ActionUpdateProfile, userID); !ok {
+		return
+	}
+
+	var body struct {
+		Handle string `json:"handle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := services.SetHandle(userID, body.Handle); err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidHandle), errors.Is(err, services.ErrReservedHandle):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrHandleTaken):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, services.ErrHandleChangeTooSoon):
+			http.Error(w, err.Error(), http.StatusTooManyRequests)
+		case errors.Is(err, services.ErrUserNotFound):
+			http.Error(w, "Profile not found", http.StatusNotFound)
+		default:
+			log.Printf("Failed to update handle of user %d: %v", userID, err)
+			http.Error(w, "Failed to update handle", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Handle updated successfully", "handle": body.Handle})
+}
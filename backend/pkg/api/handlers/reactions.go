@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"Social/pkg/models"
+	"Social/pkg/services"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// reactionActions maps each kind of target to the action of reacting to it
+var reactionActions = map[string]services.Action{
+	models.ReactionTargetPost:    services.ActionReactToPost,
+	models.ReactionTargetComment: services.ActionReactToComment,
+	models.ReactionTargetMessage: services.ActionReactToMessage,
+}
+
+// authorizeReaction checks that the current user may react to the target and returns their ID
+func authorizeReaction(w http.ResponseWriter, r *http.Request, targetType string, targetID int) (int, bool) {
+	action, ok := reactionActions[targetType]
+	if !ok {
+		http.Error(w, services.ErrInvalidReactionTarget.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	return authorize(w, r, action, targetID)
+}
+
+// toggleReaction records a reaction of the current user and writes the new summary of the target
+func toggleReaction(w http.ResponseWriter, r *http.Request, targetType string, targetID int, reactionType string) {
+	userID, ok := authorizeReaction(w, r, targetType, targetID)
+	if !ok {
+		return
+	}
+
+	summary, err := services.ToggleReaction(userID, targetType, targetID, reactionType)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+	writeReactionSummary(w, summary)
+}
+
+// React handles POST requests to react to a post, a comment or a chat message.
+// Sending the current reaction again removes it, sending another type replaces it.
+func React(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		TargetType string `json:"target_type"`
+		TargetID   int    `json:"target_id"`
+		Type       string `json:"type"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	toggleReaction(w, r, request.TargetType, request.TargetID, request.Type)
+}
+
+// RemoveReaction handles DELETE requests to remove the current user's reaction to a target
+func RemoveReaction(w http.ResponseWriter, r *http.Request) {
+	targetType, targetID, ok := reactionTarget(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := authorizeReaction(w, r, targetType, targetID)
+	if !ok {
+		return
+	}
+
+	summary, err := services.RemoveReaction(userID, targetType, targetID)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+	writeReactionSummary(w, summary)
+}
+
+// GetReactions handles GET requests for the reaction counts of a target and the current user's reaction
+func GetReactions(w http.ResponseWriter, r *http.Request) {
+	targetType, targetID, ok := reactionTarget(w, r)
+	if !ok {
+		return
+	}
+	userID, ok := authorizeReaction(w, r, targetType, targetID)
+	if !ok {
+		return
+	}
+
+	summary, err := services.GetReactionSummary(userID, targetType, targetID)
+	if err != nil {
+		writeReactionError(w, err)
+		return
+	}
+	writeReactionSummary(w, summary)
+}
+
+// reactionTarget reads the target_type and target_id query parameters
+func reactionTarget(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	targetType := r.URL.Query().Get("target_type")
+	targetID, err := strconv.Atoi(r.URL.Query().Get("target_id"))
+	if err != nil {
+		http.Error(w, "Invalid target ID", http.StatusBadRequest)
+		return "", 0, false
+	}
+	return targetType, targetID, true
+}
+
+func writeReactionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, services.ErrInvalidReactionType) || errors.Is(err, services.ErrInvalidReactionTarget) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("Failed to update reaction: %v", err)
+	http.Error(w, "Failed to update reaction", http.StatusInternalServerError)
+}
+
+func writeReactionSummary(w http.ResponseWriter, summary models.ReactionSummary) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(summary); err != nil {
+		http.Error(w, "Failed to encode reactions", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"Social/pkg/services"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GetRecommendations handles GET requests for the accounts the current user
+// may know. Query parameters: offset and limit.
+func GetRecommendations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	var offset, limit int
+	var err error
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		if offset, err = strconv.Atoi(offsetStr); err != nil {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	recommendations, err := services.GetRecommendations(userID, offset, limit)
+	if err != nil {
+		log.Printf("Failed to get recommendations for user %d: %v", userID, err)
+		http.Error(w, "Failed to retrieve recommendations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(recommendations); err != nil {
+		http.Error(w, "Failed to encode recommendations", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"Social/pkg/api/middlewares"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Logout handles POST requests to end the current session
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID, ok := r.Context().Value("sessionID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := middlewares.DeleteSession(sessionID); err != nil {
+		log.Printf("Error deleting session: %v", err)
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		return
+	}
+	if userID, ok := r.Context().Value("userID").(int); ok {
+		hub.closeSessions(userID, func(id string) bool { return id == sessionID })
+	}
+
+	middlewares.ClearSessionCookie(w)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logout successful"})
+}
+
+// GetSessions handles GET requests to list the active sessions of the current user
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, _ := r.Context().Value("sessionID").(string)
+
+	sessions, err := middlewares.ListSessions(userID, sessionID)
+	if err != nil {
+		log.Printf("Failed to list sessions for user %d: %v", userID, err)
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(sessions); err != nil {
+		http.Error(w, "Failed to encode sessions", http.StatusInternalServerError)
+	}
+}
+
+// RevokeSession handles DELETE requests to end one of the current user's sessions
+func RevokeSession(w http.ResponseWriter, r *http.Request, idStr string) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	revokedID, err := middlewares.DeleteUserSession(userID, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Failed to revoke session %d: %v", id, err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+
+	// Sockets opened with the session must not outlive it
+	hub.closeSessions(userID, func(id string) bool { return id == revokedID })
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions handles DELETE requests to end every session except the current one
+func RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	sessionID, ok := r.Context().Value("sessionID").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := middlewares.DeleteOtherSessions(userID, sessionID); err != nil {
+		log.Printf("Failed to revoke other sessions for user %d: %v", userID, err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	hub.closeSessions(userID, func(id string) bool { return id != sessionID })
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Other sessions revoked successfully"})
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"Social/pkg/models"
 	"Social/pkg/services"
+	"encoding/json"
+	"errors"
 	"log"
 	"sync"
 	"time"
@@ -10,21 +12,159 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var clients = make(map[*websocket.Conn]bool) // Connected clients
-var broadcast = make(chan models.Chat)       // Broadcast channel
-var mutex = &sync.Mutex{}
+const (
+	// clientSendBuffer is how many messages may wait for a slow connection
+	// before it is dropped
+	clientSendBuffer = 32
 
-func HandleWebSocket(conn *websocket.Conn) {
-	// Register the new client
-	mutex.Lock()
-	clients[conn] = true
-	mutex.Unlock()
+	// writeWait is how long a single write to a connection may take
+	writeWait = 10 * time.Second
+)
+
+// client is an open WebSocket connection of a user. Messages for it are
+// queued on send and written by its own writer goroutine, so that a stalled
+// connection never holds up the hub.
+type client struct {
+	userID    int
+	sessionID string // session the connection was opened with
+	conn      *websocket.Conn
+	send      chan models.Chat
+}
+
+// writeLoop writes the queued messages to the connection until send is closed
+func (c *client) writeLoop() {
+	defer c.conn.Close()
+	for message := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := c.conn.WriteJSON(message); err != nil {
+			log.Printf("Error writing JSON to user %d: %v", c.userID, err)
+			return
+		}
+	}
+}
+
+// Hub keeps track of the open WebSocket connections of every authenticated
+// user and routes each chat message only to the sockets allowed to see it.
+type Hub struct {
+	clients   map[int]map[*client]bool // userID -> open connections
+	broadcast chan models.Chat
+	mutex     sync.Mutex
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		clients:   make(map[int]map[*client]bool),
+		broadcast: make(chan models.Chat),
+	}
+}
+
+var hub = NewHub()
+
+// register adds a connection opened with sessionID to the set of sockets owned
+// by userID and starts its writer
+func (h *Hub) register(userID int, sessionID string, conn *websocket.Conn) *client {
+	c := &client{userID: userID, sessionID: sessionID, conn: conn, send: make(chan models.Chat, clientSendBuffer)}
+
+	h.mutex.Lock()
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*client]bool)
+	}
+	h.clients[userID][c] = true
+	h.mutex.Unlock()
+
+	go c.writeLoop()
+	return c
+}
+
+// unregister removes a connection and forgets the user once they have no sockets left
+func (h *Hub) unregister(c *client) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.removeLocked(c)
+}
+
+// removeLocked removes a connection and stops its writer, which then closes
+// it. It does nothing when the connection was already removed.
+func (h *Hub) removeLocked(c *client) {
+	conns := h.clients[c.userID]
+	if !conns[c] {
+		return
+	}
+	delete(conns, c)
+	close(c.send)
+	if len(conns) == 0 {
+		delete(h.clients, c.userID)
+	}
+}
+
+// closeSessions closes the connections of userID opened with a session for
+// which revoked returns true, once the session has been ended
+func (h *Hub) closeSessions(userID int, revoked func(sessionID string) bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for c := range h.clients[userID] {
+		if revoked(c.sessionID) {
+			h.removeLocked(c)
+			c.conn.Close()
+		}
+	}
+}
+
+// recipients returns the IDs of the users that should receive the message:
+// the sender and recipient of a direct message, or the current members of a group
+func (h *Hub) recipients(message models.Chat) ([]int, error) {
+	if message.IsGroup {
+		return services.GetGroupMemberIDs(message.GroupID)
+	}
+	if message.SenderID == message.RecipientID {
+		return []int{message.SenderID}, nil
+	}
+	return []int{message.SenderID, message.RecipientID}, nil
+}
+
+// deliver queues the message for every open socket of its recipients.
+// Connections too slow to keep up with their queue are dropped.
+func (h *Hub) deliver(message models.Chat) {
+	userIDs, err := h.recipients(message)
+	if err != nil {
+		log.Printf("Error resolving message recipients: %v", err)
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, userID := range userIDs {
+		for c := range h.clients[userID] {
+			select {
+			case c.send <- message:
+			default:
+				log.Printf("Dropping slow connection of user %d", userID)
+				h.removeLocked(c)
+			}
+		}
+	}
+}
+
+// run delivers messages from the broadcast channel until the program exits
+func (h *Hub) run() {
+	for message := range h.broadcast {
+		h.deliver(message)
+	}
+}
+
+// HandleWebSocket reads chat messages sent by the authenticated user over conn,
+// opened with sessionID
+func HandleWebSocket(conn *websocket.Conn, userID int, sessionID string) {
+	// Register the new client under its session user
+	c := hub.register(userID, sessionID, conn)
 
 	// Ensure connection is closed when the function ends
 	defer func() {
-		mutex.Lock()
-		delete(clients, conn)
-		mutex.Unlock()
+		hub.unregister(c)
 		conn.Close()
 	}()
 
@@ -33,48 +173,71 @@ func HandleWebSocket(conn *websocket.Conn) {
 		var message models.Chat
 		err := conn.ReadJSON(&message)
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err) {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				log.Printf("Error reading JSON: %v", err)
+				continue
+			}
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
 				log.Printf("Unexpected WebSocket closure: %v", err)
-				break
 			}
-			log.Printf("Error reading JSON: %v", err)
-			continue
+			break
 		}
 
-		// Log the received message
-		log.Printf("Received WebSocket message: %+v", message)
+		// The sender always comes from the session, never from the client payload
+		message.SenderID = userID
+		message.CreatedAt = time.Now()
 
-		// Ensure that SenderID and RecipientID are populated correctly
-		if message.CreatedAt.IsZero() {
-			message.CreatedAt = time.Now()
+		if err := validateChatMessage(&message); err != nil {
+			log.Printf("Rejected message from user %d: %v", userID, err)
+			continue
 		}
 
 		// Store the message in the database
-		if err := services.SendMessage(message); err != nil {
+		id, err := services.SendMessage(message)
+		if err != nil {
 			log.Printf("Error saving message: %v", err)
 			continue
 		}
+		message.ID = id
 
-		// Broadcast the message to all connected clients
-		broadcast <- message
+		// Hand the message to the hub for delivery to its recipients
+		hub.broadcast <- message
 	}
 }
 
-// HandleMessages listens for messages on the broadcast channel and sends them to all clients
-func HandleMessages() {
-	for {
-		// Grab the next message from the broadcast channel
-		message := <-broadcast
-
-		// Send it out to every client that is currently connected
-		mutex.Lock()
-		for client := range clients {
-			if err := client.WriteJSON(message); err != nil {
-				log.Printf("Error writing JSON: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
+// validateChatMessage checks that a direct message has a recipient and that
+// the sender of a group message is currently a member of that group
+func validateChatMessage(message *models.Chat) error {
+	// Messages carrying an image may have no text
+	if message.Message == "" && message.MediaID == nil {
+		return errors.New("message cannot be empty")
+	}
+
+	if !message.IsGroup {
+		if message.RecipientID == 0 {
+			return errors.New("recipient is required")
 		}
-		mutex.Unlock()
+		message.GroupID = 0
+		return nil
 	}
+
+	if message.GroupID == 0 {
+		return errors.New("group is required")
+	}
+	isMember, err := services.IsGroupMember(message.GroupID, message.SenderID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return errors.New("sender is not a member of the group")
+	}
+	message.RecipientID = 0
+	return nil
+}
+
+// HandleMessages listens for messages on the hub and routes them to their recipients
+func HandleMessages() {
+	hub.run()
 }
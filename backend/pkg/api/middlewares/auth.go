@@ -2,6 +2,7 @@ package middlewares
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"time"
 )
@@ -20,8 +21,13 @@ func SessionAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if err := TouchSession(sessionID.Value); err != nil {
+			log.Printf("Failed to update session last-seen time: %v", err)
+		}
+
 		ctx := r.Context()
 		ctx = context.WithValue(ctx, "userID", userID)
+		ctx = context.WithValue(ctx, "sessionID", sessionID.Value)
 		r = r.WithContext(ctx)
 
 		next.ServeHTTP(w, r)
@@ -40,3 +46,17 @@ func SetSessionCookie(w http.ResponseWriter, sessionID string) {
 		Path:     "/",
 	})
 }
+
+// ClearSessionCookie removes the session cookie from the browser
+func ClearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_id",
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   false, // Set to true for production with HTTPS
+		SameSite: http.SameSiteStrictMode,
+		Path:     "/",
+	})
+}
@@ -2,19 +2,27 @@ package middlewares
 
 import (
 	"Social/pkg/db"
+	"Social/pkg/models"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
 	"log"
+	"net"
+	"net/http"
 	"time"
 )
 
-// GenerateSessionID generates a new session ID
-func GenerateSessionID(userID int) (string, error) {
+// lastSeenInterval limits how often a session's last-seen time is written
+const lastSeenInterval = time.Minute
+
+// GenerateSessionID generates a new session ID for the device making the request
+func GenerateSessionID(userID int, r *http.Request) (string, error) {
 	sessionID := generateRandomString(32)
-	expiresAt := time.Now().Add(24 * time.Hour) // Sessions expire after 24 hours
+	now := time.Now()
+	expiresAt := now.Add(24 * time.Hour) // Sessions expire after 24 hours
 
-	_, err := db.DB.Exec("INSERT INTO sessions (session_id, user_id, expires_at) VALUES (?, ?, ?)", sessionID, userID, expiresAt)
+	_, err := db.DB.Exec(`INSERT INTO sessions (session_id, user_id, expires_at, created_at, last_seen_at, ip_address, user_agent)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, sessionID, userID, expiresAt, now, now, clientIP(r), r.UserAgent())
 	if err != nil {
 		return "", err
 	}
@@ -41,12 +49,67 @@ func RetrieveSession(sessionID string) (int, error) {
 	return userID, nil
 }
 
+// TouchSession records that the session was just used
+func TouchSession(sessionID string) error {
+	now := time.Now()
+	_, err := db.DB.Exec(`UPDATE sessions SET last_seen_at = ?
+		WHERE session_id = ? AND (last_seen_at IS NULL OR last_seen_at < ?)`, now, sessionID, now.Add(-lastSeenInterval))
+	return err
+}
+
+// ListSessions returns the active sessions of a user, most recently used first.
+// The session matching currentSessionID is flagged as the current one.
+func ListSessions(userID int, currentSessionID string) ([]models.Session, error) {
+	rows, err := db.DB.Query(`SELECT id, session_id, created_at, last_seen_at, expires_at, COALESCE(ip_address, ''), COALESCE(user_agent, '')
+		FROM sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC`, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		var sessionID string
+		if err := rows.Scan(&session.ID, &sessionID, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.IPAddress, &session.UserAgent); err != nil {
+			return nil, err
+		}
+		session.Current = sessionID == currentSessionID
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
 // DeleteSession deletes a session by session ID
 func DeleteSession(sessionID string) error {
 	_, err := db.DB.Exec("DELETE FROM sessions WHERE session_id = ?", sessionID)
 	return err
 }
 
+// DeleteUserSession deletes one of the user's sessions by its listed ID and
+// returns the ID of the deleted session. It returns sql.ErrNoRows if the user
+// has no such session.
+func DeleteUserSession(userID, id int) (string, error) {
+	var sessionID string
+	err := db.DB.QueryRow("DELETE FROM sessions WHERE id = ? AND user_id = ? RETURNING session_id", id, userID).Scan(&sessionID)
+	return sessionID, err
+}
+
+// DeleteOtherSessions deletes every session of the user except keepSessionID
+func DeleteOtherSessions(userID int, keepSessionID string) error {
+	_, err := db.DB.Exec("DELETE FROM sessions WHERE user_id = ? AND session_id != ?", userID, keepSessionID)
+	return err
+}
+
+// clientIP returns the address of the client that sent the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // generateRandomString generates a random string of the given length
 func generateRandomString(length int) string {
 	bytes := make([]byte, length)
@@ -10,6 +10,10 @@ import (
 func InitializeRoutes(mux *http.ServeMux) {
 	mux.Handle("/register", http.HandlerFunc(handlers.Register))
 	mux.Handle("/login", http.HandlerFunc(handlers.Login))
+	mux.Handle("/logout", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.Logout)))
+
+	mux.Handle("/sessions", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleSessionRoutes)))
+	mux.Handle("/sessions/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleSessionRoutes)))
 
 	mux.Handle("/auth/google/login", http.HandlerFunc(handlers.GoogleLogin))
 	mux.Handle("/auth/google/callback", http.HandlerFunc(handlers.GoogleCallback))
@@ -21,18 +25,29 @@ func InitializeRoutes(mux *http.ServeMux) {
 	mux.Handle("/auth/github/callback", http.HandlerFunc(handlers.GitHubCallback))
 
 	mux.Handle("/profile/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleProfileRoutes)))
+	mux.Handle("/u/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleHandleRoutes)))
+
+	mux.Handle("/search", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.Search)))
+	mux.Handle("/recommendations", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.GetRecommendations)))
 
+	mux.Handle("/feed", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.GetFeed)))         // GET request to retrieve a page of the home feed
 	mux.Handle("/allposts", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.GetAllPosts))) // GET request to retrieve posts
 	mux.Handle("/post", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.CreatePost)))      // POST request to create a post
 	mux.Handle("/post/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandlePostRoutes))) // Handle sub-routes for specific posts
 
 	mux.Handle("/posts/like", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleLikeDislikeRoutes)))
 	mux.Handle("/posts/dislike", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleLikeDislikeRoutes)))
+	mux.Handle("/reactions", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleReactionRoutes)))
+
+	mux.Handle("/media", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.UploadMedia))) // POST request to upload a file
+	mux.Handle("/media/", http.HandlerFunc(router.HandleMediaRoutes))                               // GET request to serve a media, with a session or a signed URL
 
 	mux.Handle("/comments/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleCommentRoutes)))
 
+	mux.Handle("/groups", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleGroupRoutes)))
 	mux.Handle("/groups/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleGroupRoutes)))
 
+	mux.Handle("/invitations", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.GetGroupInvitations)))
 	mux.Handle("/invitations/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleInvitationRoutes)))
 	mux.Handle("/requests/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleRequestRoutes)))
 
@@ -40,6 +55,16 @@ func InitializeRoutes(mux *http.ServeMux) {
 
 	mux.Handle("/notifications", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleNotificationRoutes)))
 
+	mux.Handle("/follow/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleFollowRoutes)))
+	mux.Handle("/followers/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleFollowerRoutes)))
+
+	mux.Handle("/blocks", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleBlockRoutes)))
+	mux.Handle("/blocks/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleBlockRoutes)))
+	mux.Handle("/mutes", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleMuteRoutes)))
+	mux.Handle("/mutes/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleMuteRoutes)))
+	mux.Handle("/audience-lists", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleAudienceListRoutes)))
+	mux.Handle("/audience-lists/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleAudienceListRoutes)))
+
 	mux.Handle("/follow-requests/", middlewares.SessionAuthMiddleware(http.HandlerFunc(router.HandleFollowRequestRoutes)))
 
 	mux.Handle("/follow-requests/accept", middlewares.SessionAuthMiddleware(http.HandlerFunc(handlers.AcceptFollowRequest)))
@@ -7,8 +7,8 @@ import (
 )
 
 func HandleGroupRoutes(w http.ResponseWriter, r *http.Request) {
-	// Extract the path after "/groups/"
-	path := strings.TrimPrefix(r.URL.Path, "/groups/")
+	// Extract the path after "/groups/", empty for the directory at "/groups"
+	path := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/groups"), "/")
 	pathSegments := strings.Split(path, "/")
 
 	if len(pathSegments) == 0 {
@@ -18,8 +18,16 @@ func HandleGroupRoutes(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		if len(pathSegments) == 2 && pathSegments[1] == "events" {
+		if path == "" {
+			handlers.ListGroups(w, r) // Handle GET /groups
+		} else if len(pathSegments) == 3 && pathSegments[1] == "events" {
 			handlers.GetGroupEvent(w, r) // Handle GET /groups/{groupID}/events/{eventID}
+		} else if len(pathSegments) == 2 && pathSegments[1] == "posts" {
+			handlers.GetGroupPosts(w, r, pathSegments[0]) // Handle GET /groups/{groupID}/posts
+		} else if len(pathSegments) == 2 && pathSegments[1] == "members" {
+			handlers.GetGroupMembers(w, r, pathSegments[0]) // Handle GET /groups/{groupID}/members
+		} else if len(pathSegments) == 2 && pathSegments[1] == "requests" {
+			handlers.GetGroupRequests(w, r, pathSegments[0]) // Handle GET /groups/{groupID}/requests
 		} else {
 			handlers.GetGroup(w, r) // Handle GET /groups/{groupID}
 		}
@@ -30,8 +38,32 @@ func HandleGroupRoutes(w http.ResponseWriter, r *http.Request) {
 			handlers.JoinGroup(w, r) // Handle POST /groups/{groupID}/join
 		} else if len(pathSegments) == 2 && pathSegments[1] == "leave" {
 			handlers.LeaveGroup(w, r) // Handle POST /groups/{groupID}/leave
+		} else if len(pathSegments) == 2 && pathSegments[1] == "posts" {
+			handlers.CreateGroupPost(w, r, pathSegments[0]) // Handle POST /groups/{groupID}/posts
 		} else if len(pathSegments) == 2 && pathSegments[1] == "events" {
 			handlers.CreateGroupEvent(w, r) // Handle POST /groups/{groupID}/events
+		} else if len(pathSegments) == 2 && pathSegments[1] == "invitations" {
+			handlers.InviteToGroup(w, r, pathSegments[0]) // Handle POST /groups/{groupID}/invitations
+		} else if len(pathSegments) == 2 && pathSegments[1] == "requests" {
+			handlers.CreateGroupRequest(w, r, pathSegments[0]) // Handle POST /groups/{groupID}/requests
+		} else if len(pathSegments) == 2 && pathSegments[1] == "transfer" {
+			handlers.TransferGroupOwnership(w, r, pathSegments[0]) // Handle POST /groups/{groupID}/transfer
+		} else {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+		}
+	case http.MethodPut:
+		if len(pathSegments) == 1 && path != "" {
+			handlers.UpdateGroup(w, r, pathSegments[0]) // Handle PUT /groups/{groupID}
+		} else if len(pathSegments) == 3 && pathSegments[1] == "members" {
+			handlers.UpdateGroupMemberRole(w, r, pathSegments[0], pathSegments[2]) // Handle PUT /groups/{groupID}/members/{userID}
+		} else {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+		}
+	case http.MethodDelete:
+		if len(pathSegments) == 1 && path != "" {
+			handlers.DeleteGroup(w, r, pathSegments[0]) // Handle DELETE /groups/{groupID}
+		} else if len(pathSegments) == 3 && pathSegments[1] == "members" {
+			handlers.RemoveGroupMember(w, r, pathSegments[0], pathSegments[2]) // Handle DELETE /groups/{groupID}/members/{userID}
 		} else {
 			http.Error(w, "Bad request", http.StatusBadRequest)
 		}
@@ -0,0 +1,51 @@
+package router
+
+import (
+	"Social/pkg/api/handlers"
+	"net/http"
+	"strings"
+)
+
+func HandleAudienceListRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the path after "/audience-lists/"
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/audience-lists"), "/")
+	var pathSegments []string
+	if path != "" {
+		pathSegments = strings.Split(path, "/")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if len(pathSegments) == 0 {
+			handlers.GetAudienceLists(w, r) // Handle GET /audience-lists
+		} else if len(pathSegments) == 1 {
+			handlers.GetAudienceList(w, r, pathSegments[0]) // Handle GET /audience-lists/{listID}
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	case http.MethodPost:
+		if len(pathSegments) == 0 {
+			handlers.CreateAudienceList(w, r) // Handle POST /audience-lists
+		} else if len(pathSegments) == 2 && pathSegments[1] == "members" {
+			handlers.AddAudienceListMember(w, r, pathSegments[0]) // Handle POST /audience-lists/{listID}/members
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	case http.MethodPut:
+		if len(pathSegments) == 1 {
+			handlers.UpdateAudienceList(w, r, pathSegments[0]) // Handle PUT /audience-lists/{listID}
+		} else {
+			http.Error(w, "List ID is required", http.StatusBadRequest)
+		}
+	case http.MethodDelete:
+		if len(pathSegments) == 1 {
+			handlers.DeleteAudienceList(w, r, pathSegments[0]) // Handle DELETE /audience-lists/{listID}
+		} else if len(pathSegments) == 3 && pathSegments[1] == "members" {
+			handlers.RemoveAudienceListMember(w, r, pathSegments[0], pathSegments[2]) // Handle DELETE /audience-lists/{listID}/members/{userID}
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
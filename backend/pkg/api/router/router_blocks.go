@@ -0,0 +1,35 @@
+package router
+
+import (
+	"Social/pkg/api/handlers"
+	"net/http"
+	"strings"
+)
+
+func HandleBlockRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the user ID from the path after "/blocks/"
+	userID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/blocks"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		if userID == "" {
+			handlers.GetBlockedUsers(w, r) // Handle GET /blocks
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	case http.MethodPost:
+		if userID != "" {
+			handlers.BlockUser(w, r, userID) // Handle POST /blocks/{userID}
+		} else {
+			http.Error(w, "User ID is required", http.StatusBadRequest)
+		}
+	case http.MethodDelete:
+		if userID != "" {
+			handlers.UnblockUser(w, r, userID) // Handle DELETE /blocks/{userID}
+		} else {
+			http.Error(w, "User ID is required", http.StatusBadRequest)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
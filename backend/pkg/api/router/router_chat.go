@@ -12,6 +12,14 @@ func HandleChatRoutes(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    // The socket belongs to the user of the session, set by the auth middleware
+    userID, ok := r.Context().Value("userID").(int)
+    sessionID, _ := r.Context().Value("sessionID").(string)
+    if !ok {
+        http.Error(w, "Unauthorized", http.StatusUnauthorized)
+        return
+    }
+
     upgrader := websocket.Upgrader{
         CheckOrigin: func(r *http.Request) bool {
             return true 
@@ -25,5 +33,5 @@ func HandleChatRoutes(w http.ResponseWriter, r *http.Request) {
     }
 
     // Ensure that HandleWebSocket is passed the connection
-    handlers.HandleWebSocket(conn)
+    handlers.HandleWebSocket(conn, userID, sessionID)
 }
\ No newline at end of file
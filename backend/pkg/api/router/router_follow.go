@@ -26,7 +26,11 @@ func HandleFollowRequestRoutes(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		handlers.CreateFollowRequest(w, r)
 	case http.MethodGet:
-		if id != "" {
+		if id == "incoming" {
+			handlers.GetIncomingFollowRequests(w, r) // Handle GET /follow-requests/incoming
+		} else if id == "outgoing" {
+			handlers.GetOutgoingFollowRequests(w, r) // Handle GET /follow-requests/outgoing
+		} else if id != "" {
 			handlers.GetFollowRequest(w, r, id)
 		} else {
 			http.Error(w, "ID required", http.StatusBadRequest)
@@ -47,3 +51,37 @@ func HandleFollowRequestRoutes(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+func HandleFollowRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the user ID from the path after "/follow/"
+	userID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/follow/"), "/")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		handlers.FollowUser(w, r, userID) // Handle POST /follow/{userID}
+	case http.MethodDelete:
+		handlers.UnfollowUser(w, r, userID) // Handle DELETE /follow/{userID}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func HandleFollowerRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the follower ID from the path after "/followers/"
+	followerID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/followers/"), "/")
+	if followerID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		handlers.RemoveFollower(w, r, followerID) // Handle DELETE /followers/{userID}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
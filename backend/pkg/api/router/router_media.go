@@ -0,0 +1,35 @@
+package router
+
+import (
+	"Social/pkg/api/handlers"
+	"Social/pkg/api/middlewares"
+	"Social/pkg/models"
+	"net/http"
+	"strings"
+)
+
+func HandleMediaRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the media ID and the optional variant from /media/{mediaID}/{variant}
+	mediaIDStr, variant, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/media/"), "/"), "/")
+	if mediaIDStr == "" {
+		http.Error(w, "Media ID is required", http.StatusBadRequest)
+		return
+	}
+	if variant == "" {
+		variant = models.MediaVariantFull
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Signed URLs grant access on their own; everything else needs a session
+	if r.URL.Query().Has("sig") {
+		handlers.ServeSignedMedia(w, r, mediaIDStr, variant) // Handle GET /media/{mediaID}/{variant}?expires=...&sig=...
+		return
+	}
+	middlewares.SessionAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.ServeMedia(w, r, mediaIDStr, variant) // Handle GET /media/{mediaID}/{variant}
+	})).ServeHTTP(w, r)
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"Social/pkg/api/handlers"
+	"net/http"
+	"strings"
+)
+
+func HandleMuteRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the mute ID from the path after "/mutes/"
+	muteID := strings.Trim(strings.TrimPrefix(r.URL.Path, "/mutes"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		if muteID == "" {
+			handlers.GetMutes(w, r) // Handle GET /mutes
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	case http.MethodPost:
+		if muteID == "" {
+			handlers.CreateMute(w, r) // Handle POST /mutes
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	case http.MethodDelete:
+		if muteID != "" {
+			handlers.DeleteMute(w, r, muteID) // Handle DELETE /mutes/{muteID}
+		} else {
+			http.Error(w, "Mute ID is required", http.StatusBadRequest)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
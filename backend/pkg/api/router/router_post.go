@@ -18,7 +18,10 @@ func HandlePostRoutes(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "GET":
-		if postIDStr != "" {
+		if postIDStr != "" && len(parts) == 2 && parts[1] == "comments" {
+			// Fetch the comments of a post
+			handlers.GetPostComments(w, r, postIDStr)
+		} else if postIDStr != "" {
 			// Fetch a specific post by ID
 			handlers.GetPost(w, r, postIDStr)
 		} else {
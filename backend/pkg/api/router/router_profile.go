@@ -16,6 +16,20 @@ func HandleProfileRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Sub-resources of a profile: /profile/{userID}/handle, /followers, /following and /mutual
+	userIDStr, kind, hasKind := strings.Cut(strings.Trim(userIDStr, "/"), "/")
+	if hasKind {
+		switch {
+		case kind == "handle" && r.Method == http.MethodPut:
+			handlers.UpdateHandle(w, r, userIDStr) // Handle PUT /profile/{userID}/handle
+		case kind != "handle" && r.Method == http.MethodGet:
+			handlers.GetProfileConnections(w, r, userIDStr, kind) // Handle GET /profile/{userID}/{followers|following|mutual}
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		handlers.GetProfile(w, r, userIDStr)
@@ -25,3 +39,19 @@ func HandleProfileRoutes(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
+
+func HandleHandleRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the handle from the path after "/u/"
+	handle := strings.Trim(strings.TrimPrefix(r.URL.Path, "/u/"), "/")
+	if handle == "" || strings.Contains(handle, "/") {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		handlers.GetProfileByHandle(w, r, handle) // Handle GET /u/{handle}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"Social/pkg/api/handlers"
+	"net/http"
+)
+
+func HandleReactionRoutes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handlers.GetReactions(w, r) // Handle GET /reactions?target_type=...&target_id=...
+	case http.MethodPost:
+		handlers.React(w, r) // Handle POST /reactions
+	case http.MethodDelete:
+		handlers.RemoveReaction(w, r) // Handle DELETE /reactions?target_type=...&target_id=...
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
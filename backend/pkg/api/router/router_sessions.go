@@ -0,0 +1,31 @@
+package router
+
+import (
+	"Social/pkg/api/handlers"
+	"net/http"
+	"strings"
+)
+
+func HandleSessionRoutes(w http.ResponseWriter, r *http.Request) {
+	// Extract the session ID from the path after "/sessions/"
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/sessions"), "/")
+
+	switch r.Method {
+	case http.MethodGet:
+		if id == "" {
+			handlers.GetSessions(w, r) // Handle GET /sessions
+		} else {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+	case http.MethodDelete:
+		if id == "others" {
+			handlers.RevokeOtherSessions(w, r) // Handle DELETE /sessions/others
+		} else if id != "" {
+			handlers.RevokeSession(w, r, id) // Handle DELETE /sessions/{sessionID}
+		} else {
+			http.Error(w, "Session ID is required", http.StatusBadRequest)
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
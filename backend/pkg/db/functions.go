@@ -0,0 +1,49 @@
+package db
+
+import (
+	"database/sql"
+	"regexp"
+	"sync"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is the SQLite driver with the functions below registered on
+// every connection
+const driverName = "sqlite3_social"
+
+// maxCachedPatterns bounds the compiled patterns kept by regexpMatch
+const maxCachedPatterns = 256
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("regexp", regexpMatch, true)
+		},
+	})
+}
+
+var (
+	patterns      = make(map[string]*regexp.Regexp)
+	patternsMutex sync.Mutex
+)
+
+// regexpMatch backs the REGEXP operator: text REGEXP pattern reports whether
+// text matches the Go regular expression pattern
+func regexpMatch(pattern, text string) (bool, error) {
+	patternsMutex.Lock()
+	re, ok := patterns[pattern]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			patternsMutex.Unlock()
+			return false, err
+		}
+		if len(patterns) >= maxCachedPatterns {
+			patterns = make(map[string]*regexp.Regexp)
+		}
+		patterns[pattern] = re
+	}
+	patternsMutex.Unlock()
+	return re.MatchString(text), nil
+}
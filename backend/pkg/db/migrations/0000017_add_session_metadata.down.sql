@@ -0,0 +1,14 @@
+DROP INDEX IF EXISTS idx_sessions_user_id;
+
+CREATE TABLE sessions_old (
+    session_id TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+INSERT INTO sessions_old (session_id, user_id, expires_at)
+SELECT session_id, user_id, expires_at FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_old RENAME TO sessions;
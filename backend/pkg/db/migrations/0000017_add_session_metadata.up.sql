@@ -0,0 +1,23 @@
+-- Sessions get a stable numeric ID to be listed and revoked by, as the
+-- implicit rowid of a table keyed by text may change on VACUUM. SQLite cannot
+-- add a primary key to an existing table, so the table is rebuilt.
+CREATE TABLE sessions_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL UNIQUE,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME,
+    last_seen_at DATETIME,
+    ip_address TEXT,
+    user_agent TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Sessions created before this migration lasted 24 hours
+INSERT INTO sessions_new (session_id, user_id, expires_at, created_at, last_seen_at)
+SELECT session_id, user_id, expires_at, datetime(expires_at, '-1 day'), datetime(expires_at, '-1 day') FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_post_audience_user_id;
+DROP TABLE IF EXISTS post_audience;
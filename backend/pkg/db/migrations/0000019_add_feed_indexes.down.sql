@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comments_post_id;
+DROP INDEX IF EXISTS idx_dislikes_post_id;
+DROP INDEX IF EXISTS idx_likes_post_id;
+DROP INDEX IF EXISTS idx_followers_followed_id;
+DROP INDEX IF EXISTS idx_posts_user_created;
@@ -0,0 +1,5 @@
+CREATE INDEX IF NOT EXISTS idx_posts_user_created ON posts(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_followers_followed_id ON followers(followed_id);
+CREATE INDEX IF NOT EXISTS idx_likes_post_id ON likes(post_id);
+CREATE INDEX IF NOT EXISTS idx_dislikes_post_id ON dislikes(post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
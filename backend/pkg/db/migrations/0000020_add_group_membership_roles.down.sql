@@ -0,0 +1 @@
+ALTER TABLE group_memberships DROP COLUMN role;
@@ -0,0 +1,11 @@
+ALTER TABLE group_memberships ADD COLUMN role TEXT NOT NULL DEFAULT 'member';
+
+-- Group creators become the owners of their groups
+INSERT OR IGNORE INTO group_memberships (user_id, group_id, joined_at, role)
+SELECT creator_id, id, created_at, 'owner' FROM groups;
+
+UPDATE group_memberships SET role = 'owner', left_at = NULL
+WHERE EXISTS (
+    SELECT 1 FROM groups g
+    WHERE g.id = group_memberships.group_id AND g.creator_id = group_memberships.user_id
+);
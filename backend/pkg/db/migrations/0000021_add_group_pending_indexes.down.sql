@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_group_invitations_invitee_id;
+DROP INDEX IF EXISTS idx_group_requests_pending;
+DROP INDEX IF EXISTS idx_group_invitations_pending;
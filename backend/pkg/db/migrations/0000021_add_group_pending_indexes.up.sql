@@ -0,0 +1,14 @@
+-- Keep only the oldest of duplicated pending invitations and requests
+DELETE FROM group_invitations
+WHERE status = 'pending' AND id NOT IN (
+    SELECT MIN(id) FROM group_invitations WHERE status = 'pending' GROUP BY group_id, invitee_id
+);
+
+DELETE FROM group_requests
+WHERE status = 'pending' AND id NOT IN (
+    SELECT MIN(id) FROM group_requests WHERE status = 'pending' GROUP BY group_id, requester_id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_invitations_pending ON group_invitations(group_id, invitee_id) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_requests_pending ON group_requests(group_id, requester_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_group_invitations_invitee_id ON group_invitations(invitee_id);
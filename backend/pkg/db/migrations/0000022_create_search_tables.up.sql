@@ -0,0 +1,59 @@
+-- Full-text indexes over posts, users and groups. They are external content
+-- tables: the text lives in the original tables and the triggers below keep
+-- the indexes in sync with them.
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+    content,
+    content='posts', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+    first_name, last_name, nickname,
+    content='users', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+    title, description,
+    content='groups', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+    VALUES (new.id, new.first_name, new.last_name, new.nickname);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, first_name, last_name, nickname)
+    VALUES ('delete', old.id, old.first_name, old.last_name, old.nickname);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF first_name, last_name, nickname ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, first_name, last_name, nickname)
+    VALUES ('delete', old.id, old.first_name, old.last_name, old.nickname);
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+    VALUES (new.id, new.first_name, new.last_name, new.nickname);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_delete AFTER DELETE ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_update AFTER UPDATE OF title, description ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+
+-- Index the rows that existed before the search tables
+INSERT INTO posts_fts(posts_fts) VALUES ('rebuild');
+INSERT INTO users_fts(users_fts) VALUES ('rebuild');
+INSERT INTO groups_fts(groups_fts) VALUES ('rebuild');
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_comments_parent_id;
+
+-- Replies lose their thread and tombstones have nothing left to show
+DELETE FROM comments WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE comments DROP COLUMN deleted_at;
+ALTER TABLE comments DROP COLUMN depth;
+ALTER TABLE comments DROP COLUMN parent_id;
@@ -0,0 +1,5 @@
+ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments(id);
+ALTER TABLE comments ADD COLUMN depth INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
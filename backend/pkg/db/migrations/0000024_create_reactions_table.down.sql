@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS likes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    created_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+
+CREATE TABLE IF NOT EXISTS dislikes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    created_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_likes_post_id ON likes(post_id);
+CREATE INDEX IF NOT EXISTS idx_dislikes_post_id ON dislikes(post_id);
+
+-- Other reactions have no equivalent and are lost
+INSERT INTO likes (user_id, post_id, created_at)
+SELECT user_id, target_id, created_at FROM reactions WHERE target_type = 'post' AND type = 'like';
+
+INSERT INTO dislikes (user_id, post_id, created_at)
+SELECT user_id, target_id, created_at FROM reactions WHERE target_type = 'post' AND type = 'dislike';
+
+DROP TABLE IF EXISTS reactions;
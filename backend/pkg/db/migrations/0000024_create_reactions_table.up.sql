@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS reactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL, -- "post", "comment" or "message"
+    target_id INTEGER NOT NULL,
+    type TEXT NOT NULL, -- "like", "dislike", "love", "haha", "wow", "sad" or "angry"
+    created_at DATETIME NOT NULL,
+    UNIQUE (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions(target_type, target_id);
+
+-- Users who both liked and disliked a post keep their latest reaction
+INSERT INTO reactions (user_id, target_type, target_id, type, created_at)
+SELECT user_id, 'post', post_id, 'like', COALESCE(created_at, CURRENT_TIMESTAMP) FROM likes WHERE true
+ON CONFLICT (user_id, target_type, target_id) DO NOTHING;
+
+INSERT INTO reactions (user_id, target_type, target_id, type, created_at)
+SELECT user_id, 'post', post_id, 'dislike', COALESCE(created_at, CURRENT_TIMESTAMP) FROM dislikes WHERE true
+ON CONFLICT (user_id, target_type, target_id) DO UPDATE SET type = excluded.type, created_at = excluded.created_at
+WHERE excluded.created_at > reactions.created_at;
+
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS dislikes;
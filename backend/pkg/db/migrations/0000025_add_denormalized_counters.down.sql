@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS reaction_counts;
+
+ALTER TABLE posts DROP COLUMN comment_count;
@@ -0,0 +1,18 @@
+-- Number of comments on each post, tombstones excluded
+ALTER TABLE posts ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0;
+
+UPDATE posts SET comment_count = (
+    SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL
+);
+
+-- Number of reactions of each type to each target
+CREATE TABLE IF NOT EXISTS reaction_counts (
+    target_type TEXT NOT NULL, -- "post", "comment" or "message"
+    target_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (target_type, target_id, type)
+);
+
+INSERT INTO reaction_counts (target_type, target_id, type, count)
+SELECT target_type, target_id, type, COUNT(*) FROM reactions GROUP BY target_type, target_id, type;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS mutes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL, -- "user", "group" or "keyword"
+    target_id INTEGER NOT NULL DEFAULT 0, -- muted user or group, 0 for keywords
+    keyword TEXT NOT NULL DEFAULT '', -- muted word or phrase in lower case, empty for users and groups
+    expires_at DATETIME, -- NULL for mutes that last until removed
+    created_at DATETIME NOT NULL,
+    UNIQUE (user_id, target_type, target_id, keyword),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
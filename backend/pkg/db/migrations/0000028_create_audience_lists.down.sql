@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_post_audience_lists_list_id;
+DROP INDEX IF EXISTS idx_audience_list_members_user_id;
+
+DROP TABLE IF EXISTS post_audience_lists;
+DROP TABLE IF EXISTS audience_list_members;
+DROP TABLE IF EXISTS audience_lists;
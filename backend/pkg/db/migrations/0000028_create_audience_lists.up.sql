@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS audience_lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    UNIQUE (owner_id, name),
+    FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS audience_list_members (
+    list_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (list_id, user_id),
+    FOREIGN KEY (list_id) REFERENCES audience_lists(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Lists an almost private post is shared with, on top of the users in post_audience
+CREATE TABLE IF NOT EXISTS post_audience_lists (
+    post_id INTEGER NOT NULL,
+    list_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, list_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (list_id) REFERENCES audience_lists(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_audience_list_members_user_id ON audience_list_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_post_audience_lists_list_id ON post_audience_lists(list_id);
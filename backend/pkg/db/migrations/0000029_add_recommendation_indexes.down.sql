@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_follow_requests_sender_recipient;
+DROP INDEX IF EXISTS idx_group_memberships_group_id;
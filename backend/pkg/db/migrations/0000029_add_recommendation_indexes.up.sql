@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_group_memberships_group_id ON group_memberships(group_id);
+CREATE INDEX IF NOT EXISTS idx_follow_requests_sender_recipient ON follow_requests(sender_id, recipient_id);
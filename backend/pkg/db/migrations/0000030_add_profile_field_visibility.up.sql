@@ -0,0 +1,5 @@
+-- Who may see each optional profile field: "everyone", "followers" or "only_me"
+ALTER TABLE users ADD COLUMN email_visibility TEXT NOT NULL DEFAULT 'only_me';
+ALTER TABLE users ADD COLUMN date_of_birth_visibility TEXT NOT NULL DEFAULT 'followers';
+ALTER TABLE users ADD COLUMN about_me_visibility TEXT NOT NULL DEFAULT 'everyone';
+ALTER TABLE users ADD COLUMN nickname_visibility TEXT NOT NULL DEFAULT 'everyone';
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS handle_redirects;
+
+DROP INDEX IF EXISTS idx_users_handle;
+ALTER TABLE users DROP COLUMN handle_changed_at;
+ALTER TABLE users DROP COLUMN handle;
@@ -0,0 +1,17 @@
+-- Unique, case-insensitive handle of each user, chosen at registration or onboarding
+ALTER TABLE users ADD COLUMN handle TEXT;
+ALTER TABLE users ADD COLUMN handle_changed_at DATETIME;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_handle ON users(handle COLLATE NOCASE);
+
+-- Former handles keep pointing to their user, and cannot be claimed by
+-- anyone else, until they expire
+CREATE TABLE IF NOT EXISTS handle_redirects (
+    handle TEXT NOT NULL PRIMARY KEY COLLATE NOCASE,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_handle_redirects_user_id ON handle_redirects(user_id);
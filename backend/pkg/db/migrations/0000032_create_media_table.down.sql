@@ -0,0 +1,7 @@
+ALTER TABLE users DROP COLUMN avatar_media_id;
+ALTER TABLE chats DROP COLUMN media_id;
+ALTER TABLE comments DROP COLUMN media_id;
+ALTER TABLE posts DROP COLUMN media_id;
+
+DROP INDEX IF EXISTS idx_media_owner_id;
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,17 @@
+-- Uploaded files. The bytes live in the blob store under storage_key.
+CREATE TABLE IF NOT EXISTS media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_owner_id ON media(owner_id);
+
+ALTER TABLE posts ADD COLUMN media_id INTEGER REFERENCES media(id);
+ALTER TABLE comments ADD COLUMN media_id INTEGER REFERENCES media(id);
+ALTER TABLE chats ADD COLUMN media_id INTEGER REFERENCES media(id);
+ALTER TABLE users ADD COLUMN avatar_media_id INTEGER REFERENCES media(id);
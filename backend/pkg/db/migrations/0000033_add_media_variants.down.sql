@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_media_status;
+DROP TABLE IF EXISTS media_variants;
+
+ALTER TABLE media DROP COLUMN blurhash;
+ALTER TABLE media DROP COLUMN height;
+ALTER TABLE media DROP COLUMN width;
+ALTER TABLE media DROP COLUMN status;
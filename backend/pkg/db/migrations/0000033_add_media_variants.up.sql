@@ -0,0 +1,21 @@
+-- Uploads are processed in the background into resized variants stripped of
+-- their metadata. Once ready, storage_key points to the full variant and the
+-- original upload is deleted.
+ALTER TABLE media ADD COLUMN status TEXT NOT NULL DEFAULT 'pending'; -- "pending", "processing", "ready" or "failed"
+ALTER TABLE media ADD COLUMN width INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN height INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE media ADD COLUMN blurhash TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS media_variants (
+    media_id INTEGER NOT NULL,
+    name TEXT NOT NULL, -- "thumb", "feed" or "full"
+    storage_key TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    PRIMARY KEY (media_id, name),
+    FOREIGN KEY (media_id) REFERENCES media(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_status ON media(status) WHERE status IN ('pending', 'processing');
@@ -0,0 +1,4 @@
+-- Who can find and join a group: "public" groups can be joined directly,
+-- "private" ones are listed but need an approved request and "secret" ones
+-- are only known to their members and invitees
+ALTER TABLE groups ADD COLUMN visibility TEXT NOT NULL DEFAULT 'public';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_posts_group_created;
+ALTER TABLE posts DROP COLUMN group_id;
@@ -0,0 +1,5 @@
+-- Group a post was shared in, NULL for personal posts. Group posts are seen
+-- by whoever may see the content of their group.
+ALTER TABLE posts ADD COLUMN group_id INTEGER REFERENCES groups(id);
+
+CREATE INDEX IF NOT EXISTS idx_posts_group_created ON posts(group_id, created_at, id) WHERE group_id IS NOT NULL;
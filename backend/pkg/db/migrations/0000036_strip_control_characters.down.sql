@@ -0,0 +1,2 @@
+-- The stripped characters cannot be restored
+SELECT 1;
@@ -0,0 +1,19 @@
+-- Search snippets mark matched terms with these control characters, which
+-- searchable text must not contain. They are stripped when text is written
+-- from now on; this removes them from the text written before.
+UPDATE posts SET content = replace(replace(content, char(2), ''), char(3), '')
+WHERE instr(content, char(2)) > 0 OR instr(content, char(3)) > 0;
+
+UPDATE users SET
+    first_name = replace(replace(first_name, char(2), ''), char(3), ''),
+    last_name = replace(replace(last_name, char(2), ''), char(3), ''),
+    nickname = replace(replace(nickname, char(2), ''), char(3), '')
+WHERE instr(first_name, char(2)) > 0 OR instr(first_name, char(3)) > 0
+    OR instr(last_name, char(2)) > 0 OR instr(last_name, char(3)) > 0
+    OR instr(nickname, char(2)) > 0 OR instr(nickname, char(3)) > 0;
+
+UPDATE groups SET
+    title = replace(replace(title, char(2), ''), char(3), ''),
+    description = replace(replace(description, char(2), ''), char(3), '')
+WHERE instr(title, char(2)) > 0 OR instr(title, char(3)) > 0
+    OR instr(description, char(2)) > 0 OR instr(description, char(3)) > 0;
@@ -11,7 +11,58 @@ CREATE TABLE IF NOT EXISTS users (
     provider TEXT,
     is_private BOOLEAN DEFAULT FALSE,
     created_at DATETIME NOT NULL,
-    updated_at DATETIME NOT NULL
+    updated_at DATETIME NOT NULL,
+    -- Who may see each optional profile field: "everyone", "followers" or "only_me"
+    email_visibility TEXT NOT NULL DEFAULT 'only_me',
+    date_of_birth_visibility TEXT NOT NULL DEFAULT 'followers',
+    about_me_visibility TEXT NOT NULL DEFAULT 'everyone',
+    nickname_visibility TEXT NOT NULL DEFAULT 'everyone',
+    -- Unique, case-insensitive handle, chosen at registration or onboarding
+    handle TEXT,
+    handle_changed_at DATETIME,
+    avatar_media_id INTEGER REFERENCES media(id)
+);
+
+
+-- Former handles keep pointing to their user, and cannot be claimed by
+-- anyone else, until they expire
+CREATE TABLE IF NOT EXISTS handle_redirects (
+    handle TEXT NOT NULL PRIMARY KEY COLLATE NOCASE,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+
+-- Uploaded files. The bytes live in the blob store under storage_key.
+CREATE TABLE IF NOT EXISTS media (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    storage_key TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    -- Uploads are processed in the background into resized variants stripped
+    -- of their metadata. Once ready, storage_key points to the full variant
+    -- and the original upload is deleted.
+    status TEXT NOT NULL DEFAULT 'pending', -- "pending", "processing", "ready" or "failed"
+    width INTEGER NOT NULL DEFAULT 0,
+    height INTEGER NOT NULL DEFAULT 0,
+    blurhash TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS media_variants (
+    media_id INTEGER NOT NULL,
+    name TEXT NOT NULL, -- "thumb", "feed" or "full"
+    storage_key TEXT NOT NULL UNIQUE,
+    content_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size INTEGER NOT NULL,
+    PRIMARY KEY (media_id, name),
+    FOREIGN KEY (media_id) REFERENCES media(id)
 );
 
 
@@ -23,6 +74,9 @@ CREATE TABLE IF NOT EXISTS posts (
     privacy TEXT NOT NULL,
     created_at DATETIME NOT NULL,
     updated_at DATETIME NOT NULL,
+    comment_count INTEGER NOT NULL DEFAULT 0, -- comments on the post, tombstones excluded
+    media_id INTEGER REFERENCES media(id),
+    group_id INTEGER REFERENCES groups(id), -- group the post was shared in, NULL for personal posts
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
@@ -42,7 +96,8 @@ CREATE TABLE IF NOT EXISTS groups (
     title TEXT NOT NULL,
     description TEXT,
     created_at DATETIME NOT NULL,
-    updated_at DATETIME NOT NULL
+    updated_at DATETIME NOT NULL,
+    visibility TEXT NOT NULL DEFAULT 'public' -- "public", "private" or "secret"
 );
 
 CREATE TABLE IF NOT EXISTS group_invitations (
@@ -95,6 +150,7 @@ CREATE TABLE IF NOT EXISTS group_memberships (
     group_id INTEGER NOT NULL,
     joined_at DATETIME NOT NULL,
     left_at DATETIME,
+    role TEXT NOT NULL DEFAULT 'member', -- "owner", "admin", "moderator" or "member"
     PRIMARY KEY (user_id, group_id),
     FOREIGN KEY (user_id) REFERENCES users(id),
     FOREIGN KEY (group_id) REFERENCES groups(id)
@@ -108,6 +164,7 @@ CREATE TABLE IF NOT EXISTS chats (
     message TEXT NOT NULL,
     is_group BOOLEAN NOT NULL,
     created_at DATETIME,
+    media_id INTEGER REFERENCES media(id),
     FOREIGN KEY (sender_id) REFERENCES users(id),
     FOREIGN KEY (recipient_id) REFERENCES users(id),
     FOREIGN KEY (group_id) REFERENCES groups(id)
@@ -133,31 +190,40 @@ CREATE TABLE IF NOT EXISTS follow_requests (
     FOREIGN KEY (recipient_id) REFERENCES users(id)
 );
 
-CREATE TABLE IF NOT EXISTS likes (
+CREATE TABLE IF NOT EXISTS reactions (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
-    post_id INTEGER NOT NULL,
-    created_at DATETIME,
-    FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (post_id) REFERENCES posts(id)
+    target_type TEXT NOT NULL, -- "post", "comment" or "message"
+    target_id INTEGER NOT NULL,
+    type TEXT NOT NULL, -- "like", "dislike", "love", "haha", "wow", "sad" or "angry"
+    created_at DATETIME NOT NULL,
+    UNIQUE (user_id, target_type, target_id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
-CREATE TABLE IF NOT EXISTS dislikes (
-    id INTEGER PRIMARY KEY AUTOINCREMENT,
-    user_id INTEGER NOT NULL,
-    post_id INTEGER NOT NULL,
-    created_at DATETIME,
-    FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (post_id) REFERENCES posts(id)
+-- Number of reactions of each type to each target, kept up to date on write
+CREATE TABLE IF NOT EXISTS reaction_counts (
+    target_type TEXT NOT NULL, -- "post", "comment" or "message"
+    target_id INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (target_type, target_id, type)
 );
 
 CREATE TABLE IF NOT EXISTS sessions (
-    session_id TEXT PRIMARY KEY,
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL UNIQUE,
     user_id INTEGER NOT NULL,
     expires_at DATETIME NOT NULL,
+    created_at DATETIME,
+    last_seen_at DATETIME,
+    ip_address TEXT,
+    user_agent TEXT,
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
 
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+
 CREATE TABLE IF NOT EXISTS comments (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     user_id INTEGER NOT NULL,
@@ -165,6 +231,152 @@ CREATE TABLE IF NOT EXISTS comments (
     content TEXT NOT NULL,
     created_at DATETIME,
     updated_at DATETIME,
+    parent_id INTEGER, -- the comment this one replies to, NULL for top-level comments
+    depth INTEGER NOT NULL DEFAULT 0, -- 0 for top-level comments
+    deleted_at DATETIME, -- set when a comment with replies is deleted and left as a tombstone
+    media_id INTEGER REFERENCES media(id),
     FOREIGN KEY (user_id) REFERENCES users(id),
-    FOREIGN KEY (post_id) REFERENCES posts(id)
-);
\ No newline at end of file
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (parent_id) REFERENCES comments(id)
+);
+
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker_id INTEGER NOT NULL,
+    blocked_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id),
+    FOREIGN KEY (blocked_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS mutes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL, -- "user", "group" or "keyword"
+    target_id INTEGER NOT NULL DEFAULT 0, -- muted user or group, 0 for keywords
+    keyword TEXT NOT NULL DEFAULT '', -- muted word or phrase in lower case, empty for users and groups
+    expires_at DATETIME, -- NULL for mutes that last until removed
+    created_at DATETIME NOT NULL,
+    UNIQUE (user_id, target_type, target_id, keyword),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS post_audience (
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_audience_user_id ON post_audience(user_id);
+
+CREATE TABLE IF NOT EXISTS audience_lists (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    UNIQUE (owner_id, name),
+    FOREIGN KEY (owner_id) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS audience_list_members (
+    list_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    PRIMARY KEY (list_id, user_id),
+    FOREIGN KEY (list_id) REFERENCES audience_lists(id),
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+-- Lists an almost private post is shared with, on top of the users in post_audience
+CREATE TABLE IF NOT EXISTS post_audience_lists (
+    post_id INTEGER NOT NULL,
+    list_id INTEGER NOT NULL,
+    PRIMARY KEY (post_id, list_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id),
+    FOREIGN KEY (list_id) REFERENCES audience_lists(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_user_created ON posts(user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_followers_followed_id ON followers(followed_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_invitations_pending ON group_invitations(group_id, invitee_id) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_group_requests_pending ON group_requests(group_id, requester_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_group_invitations_invitee_id ON group_invitations(invitee_id);
+
+-- Full-text indexes over posts, users and groups. They are external content
+-- tables: the text lives in the original tables and the triggers below keep
+-- the indexes in sync with them.
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+    content,
+    content='posts', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS users_fts USING fts5(
+    first_name, last_name, nickname,
+    content='users', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE IF NOT EXISTS groups_fts USING fts5(
+    title, description,
+    content='groups', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+    INSERT INTO posts_fts(posts_fts, rowid, content) VALUES ('delete', old.id, old.content);
+    INSERT INTO posts_fts(rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_fts_insert AFTER INSERT ON users BEGIN
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+    VALUES (new.id, new.first_name, new.last_name, new.nickname);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_delete AFTER DELETE ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, first_name, last_name, nickname)
+    VALUES ('delete', old.id, old.first_name, old.last_name, old.nickname);
+END;
+CREATE TRIGGER IF NOT EXISTS users_fts_update AFTER UPDATE OF first_name, last_name, nickname ON users BEGIN
+    INSERT INTO users_fts(users_fts, rowid, first_name, last_name, nickname)
+    VALUES ('delete', old.id, old.first_name, old.last_name, old.nickname);
+    INSERT INTO users_fts(rowid, first_name, last_name, nickname)
+    VALUES (new.id, new.first_name, new.last_name, new.nickname);
+END;
+
+CREATE TRIGGER IF NOT EXISTS groups_fts_insert AFTER INSERT ON groups BEGIN
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_delete AFTER DELETE ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+END;
+CREATE TRIGGER IF NOT EXISTS groups_fts_update AFTER UPDATE OF title, description ON groups BEGIN
+    INSERT INTO groups_fts(groups_fts, rowid, title, description) VALUES ('delete', old.id, old.title, old.description);
+    INSERT INTO groups_fts(rowid, title, description) VALUES (new.id, new.title, new.description);
+END;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
+
+CREATE INDEX IF NOT EXISTS idx_reactions_target ON reactions(target_type, target_id);
+
+CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks(blocked_id);
+
+CREATE INDEX IF NOT EXISTS idx_audience_list_members_user_id ON audience_list_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_post_audience_lists_list_id ON post_audience_lists(list_id);
+
+CREATE INDEX IF NOT EXISTS idx_group_memberships_group_id ON group_memberships(group_id);
+CREATE INDEX IF NOT EXISTS idx_follow_requests_sender_recipient ON follow_requests(sender_id, recipient_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_handle ON users(handle COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS idx_handle_redirects_user_id ON handle_redirects(user_id);
+
+CREATE INDEX IF NOT EXISTS idx_media_owner_id ON media(owner_id);
+CREATE INDEX IF NOT EXISTS idx_media_status ON media(status) WHERE status IN ('pending', 'processing');
+
+CREATE INDEX IF NOT EXISTS idx_posts_group_created ON posts(group_id, created_at, id) WHERE group_id IS NOT NULL;
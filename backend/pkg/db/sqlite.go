@@ -2,6 +2,8 @@ package db
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
 	"path/filepath"
 
@@ -19,11 +21,17 @@ func Initialize() error {
 
 	// Open a connection to the SQLite database
 	var err error
-	DB, err = sql.Open("sqlite3", "./socialNetwork1.db")
+	DB, err = sql.Open(driverName, "./socialNetwork1.db")
 	if err != nil {
 		return err
 	}
 
+	// Search relies on FTS5, which go-sqlite3 only compiles in when built
+	// with the sqlite_fts5 tag
+	if err := checkFTS5(); err != nil {
+		return err
+	}
+
 	// Create a new migration instance with the absolute path
 	m, err := migrate.New(
 		"file://"+filepath.ToSlash(migrationsDir),
@@ -43,3 +51,18 @@ func Initialize() error {
 	log.Println("Migrations applied successfully")
 	return nil
 }
+
+// ErrFTS5Missing is returned when SQLite was built without the FTS5 extension
+var ErrFTS5Missing = errors.New("SQLite was built without FTS5, build or run the server with -tags sqlite_fts5 (e.g. go run -tags sqlite_fts5 .)")
+
+// checkFTS5 returns ErrFTS5Missing unless the linked SQLite supports FTS5
+func checkFTS5() error {
+	var enabled bool
+	if err := DB.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&enabled); err != nil {
+		return fmt.Errorf("failed to check SQLite compile options: %w", err)
+	}
+	if !enabled {
+		return ErrFTS5Missing
+	}
+	return nil
+}
@@ -8,27 +8,119 @@ const (
 	PrivacyPrivate       = "private"
 	PrivacyAlmostPrivate = "almost_private"
 
+	// Reaction types
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+	ReactionLove    = "love"
+	ReactionHaha    = "haha"
+	ReactionWow     = "wow"
+	ReactionSad     = "sad"
+	ReactionAngry   = "angry"
+
+	// Kinds of things users can react to
+	ReactionTargetPost    = "post"
+	ReactionTargetComment = "comment"
+	ReactionTargetMessage = "message"
+
 	// Follow request statuses
 	FollowRequestPending  = "pending"
 	FollowRequestAccepted = "accepted"
 	FollowRequestRejected = "rejected"
+
+	// Roles of group members, from the most to the least privileged
+	GroupRoleOwner     = "owner"
+	GroupRoleAdmin     = "admin"
+	GroupRoleModerator = "moderator"
+	GroupRoleMember    = "member"
+
+	// Kinds of things users can mute
+	MuteTargetUser    = "user"
+	MuteTargetGroup   = "group"
+	MuteTargetKeyword = "keyword"
+
+	// Statuses of group invitations and join requests
+	GroupStatusPending  = "pending"
+	GroupStatusAccepted = "accepted"
+	GroupStatusRejected = "rejected"
+
+	// Who can find, join and see the content of a group
+	GroupVisibilityPublic  = "public"
+	GroupVisibilityPrivate = "private"
+	GroupVisibilitySecret  = "secret"
+
+	// How a viewer relates to a group listed in the group directory
+	GroupViewerMember    = "member"
+	GroupViewerInvited   = "invited"
+	GroupViewerRequested = "requested"
+	GroupViewerNone      = "none"
+
+	// Who may see an optional profile field
+	VisibilityEveryone  = "everyone"
+	VisibilityFollowers = "followers"
+	VisibilityOnlyMe    = "only_me"
+
+	// Processing statuses of uploaded media
+	MediaStatusPending    = "pending"
+	MediaStatusProcessing = "processing"
+	MediaStatusReady      = "ready"
+	MediaStatusFailed     = "failed"
+
+	// Resized variants of uploaded images, from the smallest to the largest
+	MediaVariantThumb = "thumb"
+	MediaVariantFeed  = "feed"
+	MediaVariantFull  = "full"
 )
 
 type User struct {
-	ID          int       `json:"id"`
-	Email       string    `json:"email"`
-	Password    string    `json:"-"`
-	FirstName   string    `json:"first_name"`
-	LastName    string    `json:"last_name"`
-	DateOfBirth string    `json:"date_of_birth"`
-	Avatar      string    `json:"avatar"`
-	Nickname    string    `json:"nickname"`
-	AboutMe     string    `json:"about_me"`
-	IsPrivate   bool      `json:"is_private"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            int         `json:"id"`
+	Handle        string      `json:"handle,omitempty"`
+	Email         string      `json:"email,omitempty"`
+	Password      string      `json:"-"`
+	FirstName     string      `json:"first_name"`
+	LastName      string      `json:"last_name"`
+	DateOfBirth   string      `json:"date_of_birth,omitempty"`
+	Avatar        string      `json:"avatar"`
+	AvatarMediaID *int        `json:"avatar_media_id,omitempty"` // uploaded media used as avatar, if any
+	AvatarImage   *MediaImage `json:"avatar_image,omitempty"`    // URLs of the variants of the uploaded avatar
+	Nickname      string      `json:"nickname,omitempty"`
+	AboutMe       string      `json:"about_me,omitempty"`
+	IsPrivate     bool        `json:"is_private"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+	// Visibility of the optional fields, only shown to the user themselves
+	Visibility *FieldVisibility `json:"visibility,omitempty"`
 }
+
+// FieldVisibility tells who may see each optional field of a profile:
+// VisibilityEveryone, VisibilityFollowers or VisibilityOnlyMe
+type FieldVisibility struct {
+	Email       string `json:"email"`
+	DateOfBirth string `json:"date_of_birth"`
+	AboutMe     string `json:"about_me"`
+	Nickname    string `json:"nickname"`
+}
+
+// UserSummary is the short public card of a user shown in lists
+type UserSummary struct {
+	ID                 int    `json:"id"`
+	Handle             string `json:"handle,omitempty"`
+	FirstName          string `json:"first_name"`
+	LastName           string `json:"last_name"`
+	Nickname           string `json:"nickname,omitempty"`
+	Avatar             string `json:"avatar,omitempty"`
+	IsPrivate          bool   `json:"is_private"`
+	NicknameVisibility string `json:"-"`
+}
+
+// ProfileCard is what users who may not see a private profile get instead
+type ProfileCard struct {
+	User          UserSummary `json:"user"`
+	FollowerCount int         `json:"follower_count"`
+	Restricted    bool        `json:"restricted"`
+}
+
 type RegisterRequest struct {
+	Handle      string `json:"handle"`
 	Email       string `json:"email"`
 	Password    string `json:"password"`
 	FirstName   string `json:"first_name"`
@@ -45,34 +137,136 @@ type LoginRequest struct {
 	Password string `json:"password"`
 }
 
+// Session represents a login session of a user on one device
+type Session struct {
+	ID         int       `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
 // Post represents a post created by a user
 type Post struct {
 	ID        int       `json:"id"`
 	UserID    int       `json:"user_id"`
 	Content   string    `json:"content"`
 	Image     string    `json:"image,omitempty"`
+	MediaID   *int      `json:"media_id,omitempty"` // uploaded image of the post, if any
+	GroupID   *int      `json:"group_id,omitempty"` // group the post was shared in, if any
 	Privacy   string    `json:"privacy"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Comments  []Comment `json:"comments,omitempty"`
-	Likes     int       `json:"likes"`
-	Dislikes  int       `json:"dislikes"`
+
+	Author         *UserSummary   `json:"author,omitempty"`
+	MediaImage     *MediaImage    `json:"media_image,omitempty"` // URLs of the variants of the uploaded image
+	CommentCount   int            `json:"comment_count"`
+	Reactions      map[string]int `json:"reactions"`                 // number of reactions of each type
+	ViewerReaction string         `json:"viewer_reaction,omitempty"` // type of the viewer's reaction, if any
 }
 
-// Like represents a like on a post
-type Like struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	PostID    int       `json:"post_id"`
-	CreatedAt time.Time `json:"created_at"`
+// Media is a file uploaded by a user, referenced by ID from posts, comments,
+// avatars and chat messages
+type Media struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"owner_id"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	StorageKey  string    `json:"-"`
 }
 
-// Dislike represents a dislike on a post
-type Dislike struct {
-	ID        int       `json:"id"`
-	UserID    int       `json:"user_id"`
-	PostID    int       `json:"post_id"`
-	CreatedAt time.Time `json:"created_at"`
+// MediaImage describes a processed uploaded image to clients. The URLs of its
+// variants are only set once Status is MediaStatusReady; until then clients
+// can show a placeholder.
+type MediaImage struct {
+	ID       int    `json:"id"`
+	Status   string `json:"status"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Blurhash string `json:"blurhash,omitempty"`
+	ThumbURL string `json:"thumb_url,omitempty"`
+	FeedURL  string `json:"feed_url,omitempty"`
+	FullURL  string `json:"full_url,omitempty"`
+}
+
+// AudienceList is a named group of followers, such as "close friends", that
+// almost private posts can be shared with
+type AudienceList struct {
+	ID        int           `json:"id"`
+	OwnerID   int           `json:"owner_id"`
+	Name      string        `json:"name"`
+	Members   []UserSummary `json:"members"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// FeedPage is one page of posts along with the cursor of the next page
+type FeedPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// SearchResult is one match of a search. Snippet is an HTML-escaped excerpt
+// of the matching text with the matched terms wrapped in <mark> tags.
+type SearchResult struct {
+	Snippet string       `json:"snippet"`
+	Post    *Post        `json:"post,omitempty"`
+	User    *UserSummary `json:"user,omitempty"`
+	Group   *Group       `json:"group,omitempty"`
+}
+
+// SearchResults holds the matches of each kind, best matches first
+type SearchResults struct {
+	Posts  []SearchResult `json:"posts,omitempty"`
+	Users  []SearchResult `json:"users,omitempty"`
+	Groups []SearchResult `json:"groups,omitempty"`
+}
+
+// Connection is a user in a follower or following list, with how they
+// relate to the user viewing the list
+type Connection struct {
+	UserSummary
+	ViewerFollows bool `json:"viewer_follows"`
+	FollowsViewer bool `json:"follows_viewer"`
+}
+
+type ConnectionPage struct {
+	Users      []Connection `json:"users"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+// Recommendation is an account suggested to a user, with the signals that
+// led to it and their human readable reasons
+type Recommendation struct {
+	User                UserSummary `json:"user"`
+	FollowedByFollowing int         `json:"followed_by_following"`
+	MutualFollowers     int         `json:"mutual_followers"`
+	SharedGroups        int         `json:"shared_groups"`
+	FollowsYou          bool        `json:"follows_you"`
+	Reasons             []string    `json:"reasons"`
+}
+
+// Reaction is the reaction of a user to a post, a comment or a chat message
+type Reaction struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	TargetType string    `json:"target_type"`
+	TargetID   int       `json:"target_id"`
+	Type       string    `json:"type"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReactionSummary holds the reactions to one target as seen by a viewer
+type ReactionSummary struct {
+	TargetType     string         `json:"target_type"`
+	TargetID       int            `json:"target_id"`
+	Counts         map[string]int `json:"counts"`
+	ViewerReaction string         `json:"viewer_reaction,omitempty"`
 }
 
 // Comment represents a comment on a post
@@ -81,8 +275,36 @@ type Comment struct {
 	UserID    int       `json:"user_id"`
 	PostID    int       `json:"post_id"`
 	Content   string    `json:"content"`
+	MediaID   *int      `json:"media_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	ParentID *int      `json:"parent_id,omitempty"`
+	Depth    int       `json:"depth"`
+	Deleted  bool      `json:"deleted,omitempty"` // tombstone of a deleted comment kept for its replies
+	Replies  []Comment `json:"replies,omitempty"`
+
+	Author         *UserSummary   `json:"author,omitempty"` // nil for tombstones
+	Reactions      map[string]int `json:"reactions"`
+	ViewerReaction string         `json:"viewer_reaction,omitempty"`
+}
+
+// CommentPage is one page of the comments of a post along with the cursor of the next page
+type CommentPage struct {
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// Mute hides a user, a group or a keyword from the feed and notifications of
+// the user who muted it, until ExpiresAt if set
+type Mute struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	TargetType string     `json:"target_type"`
+	TargetID   int        `json:"target_id,omitempty"`
+	Keyword    string     `json:"keyword,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 // FollowRequest represents a follow request between users
@@ -99,34 +321,53 @@ type Group struct {
 	CreatorID   int       `json:"creator_id"`
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// GroupListing is a group as shown in the group directory, with its current
+// member count, when it was last active and how the viewer relates to it.
+// ViewerRole is only set for members.
+type GroupListing struct {
+	Group
+	MemberCount  int       `json:"member_count"`
+	LastActiveAt time.Time `json:"last_active_at"`
+	ViewerStatus string    `json:"viewer_status"`
+	ViewerRole   string    `json:"viewer_role,omitempty"`
+}
+
+// GroupPage is one page of the group directory along with the cursor of the next page
+type GroupPage struct {
+	Groups     []GroupListing `json:"groups"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
 type GroupMembership struct {
 	UserID   int        `json:"user_id"`
 	GroupID  int        `json:"group_id"`
+	Role     string     `json:"role"`
 	JoinedAt time.Time  `json:"joined_at"`
 	LeftAt   *time.Time `json:"left_at,omitempty"`
 }
 
 type GroupInvitation struct {
-	ID          int       `json:"id"`
-	GroupID     int       `json:"group_id"`
-	InviterID   int       `json:"inviter_id"`
-	InviteeID   int       `json:"invitee_id"`
-	Status      string    `json:"status"` // pending, accepted, rejected
-	InvitedAt   time.Time `json:"invited_at"`
-	RespondedAt time.Time `json:"responded_at,omitempty"`
+	ID          int        `json:"id"`
+	GroupID     int        `json:"group_id"`
+	InviterID   int        `json:"inviter_id"`
+	InviteeID   int        `json:"invitee_id"`
+	Status      string     `json:"status"` // pending, accepted, rejected
+	InvitedAt   time.Time  `json:"invited_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
 }
 
 type GroupRequest struct {
-	ID          int       `json:"id"`
-	GroupID     int       `json:"group_id"`
-	RequesterID int       `json:"requester_id"`
-	Status      string    `json:"status"` // pending, accepted, rejected
-	RequestedAt time.Time `json:"requested_at"`
-	RespondedAt time.Time `json:"responded_at,omitempty"`
+	ID          int        `json:"id"`
+	GroupID     int        `json:"group_id"`
+	RequesterID int        `json:"requester_id"`
+	Status      string     `json:"status"` // pending, accepted, rejected
+	RequestedAt time.Time  `json:"requested_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
 }
 
 type GroupEvent struct {
@@ -153,8 +394,12 @@ type Chat struct {
     RecipientID int       `json:"recipientID"`
     GroupID     int       `json:"groupID,omitempty"`
     Message     string    `json:"message"`
+    MediaID     *int      `json:"mediaID,omitempty"`
     IsGroup     bool      `json:"isGroup"`
     CreatedAt   time.Time `json:"createdAt"`
+
+    Reactions      map[string]int `json:"reactions,omitempty"`
+    ViewerReaction string         `json:"viewerReaction,omitempty"`
 }
 
 
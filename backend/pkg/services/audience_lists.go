@@ -0,0 +1,333 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxAudienceListNameLength is the longest name of an audience list, in characters
+const MaxAudienceListNameLength = 50
+
+var (
+	ErrInvalidListName   = errors.New("list name must be between 1 and 50 characters")
+	ErrDuplicateListName = errors.New("you already have a list with this name")
+	ErrNotFollower       = errors.New("audience lists can only hold your followers")
+)
+
+// CreateAudienceList creates a named list of followers of ownerID
+func CreateAudienceList(ownerID int, name string, memberIDs []int) (models.AudienceList, error) {
+	list := models.AudienceList{OwnerID: ownerID, Name: strings.TrimSpace(name)}
+	if err := validateListName(list.Name); err != nil {
+		return list, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return list, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkListNameFree(tx, ownerID, list.Name, 0); err != nil {
+		return list, err
+	}
+
+	list.CreatedAt = time.Now()
+	list.UpdatedAt = list.CreatedAt
+	res, err := tx.Exec(`INSERT INTO audience_lists (owner_id, name, created_at, updated_at) VALUES (?, ?, ?, ?)`,
+		list.OwnerID, list.Name, list.CreatedAt, list.UpdatedAt)
+	if err != nil {
+		return list, fmt.Errorf("failed to create audience list: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return list, fmt.Errorf("failed to retrieve audience list ID: %w", err)
+	}
+	list.ID = int(id)
+
+	if err := setAudienceListMembers(tx, list.ID, ownerID, memberIDs); err != nil {
+		return list, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return list, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return GetAudienceList(list.ID)
+}
+
+// GetAudienceList retrieves an audience list with its members
+func GetAudienceList(listID int) (models.AudienceList, error) {
+	var list models.AudienceList
+	err := db.DB.QueryRow(`SELECT id, owner_id, name, created_at, updated_at FROM audience_lists WHERE id = ?`,
+		listID).Scan(&list.ID, &list.OwnerID, &list.Name, &list.CreatedAt, &list.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return list, ErrNotFound
+	} else if err != nil {
+		return list, fmt.Errorf("failed to retrieve audience list: %w", err)
+	}
+
+	lists := []models.AudienceList{list}
+	if err := attachAudienceListMembers(lists); err != nil {
+		return list, err
+	}
+	return lists[0], nil
+}
+
+// ListAudienceLists returns the audience lists of ownerID with their members, by name
+func ListAudienceLists(ownerID int) ([]models.AudienceList, error) {
+	rows, err := db.DB.Query(`SELECT id, owner_id, name, created_at, updated_at FROM audience_lists
+		WHERE owner_id = ? ORDER BY name COLLATE NOCASE`, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audience lists: %w", err)
+	}
+	defer rows.Close()
+
+	var lists []models.AudienceList
+	for rows.Next() {
+		var list models.AudienceList
+		if err := rows.Scan(&list.ID, &list.OwnerID, &list.Name, &list.CreatedAt, &list.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audience list: %w", err)
+		}
+		lists = append(lists, list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over audience lists: %w", err)
+	}
+
+	if err := attachAudienceListMembers(lists); err != nil {
+		return nil, err
+	}
+	return lists, nil
+}
+
+// UpdateAudienceList renames a list and replaces its members. Followers left
+// out of the list lose access to the posts shared with it.
+func UpdateAudienceList(listID int, name string, memberIDs []int) (models.AudienceList, error) {
+	name = strings.TrimSpace(name)
+	if err := validateListName(name); err != nil {
+		return models.AudienceList{}, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.AudienceList{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	if err := tx.QueryRow(`SELECT owner_id FROM audience_lists WHERE id = ?`, listID).Scan(&ownerID); err != nil {
+		return models.AudienceList{}, notFoundOr(err, "failed to look up audience list")
+	}
+	if err := checkListNameFree(tx, ownerID, name, listID); err != nil {
+		return models.AudienceList{}, err
+	}
+
+	if _, err := tx.Exec(`UPDATE audience_lists SET name = ?, updated_at = ? WHERE id = ?`, name, time.Now(), listID); err != nil {
+		return models.AudienceList{}, fmt.Errorf("failed to update audience list: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audience_list_members WHERE list_id = ?`, listID); err != nil {
+		return models.AudienceList{}, fmt.Errorf("failed to clear audience list: %w", err)
+	}
+	if err := setAudienceListMembers(tx, listID, ownerID, memberIDs); err != nil {
+		return models.AudienceList{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.AudienceList{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return GetAudienceList(listID)
+}
+
+// DeleteAudienceList removes a list. Posts shared with it are no longer shown
+// to its members, unless they were also chosen one by one.
+func DeleteAudienceList(listID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM post_audience_lists WHERE list_id = ?`, listID); err != nil {
+		return fmt.Errorf("failed to unshare audience list: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audience_list_members WHERE list_id = ?`, listID); err != nil {
+		return fmt.Errorf("failed to clear audience list: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM audience_lists WHERE id = ?`, listID); err != nil {
+		return fmt.Errorf("failed to delete audience list: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// AddAudienceListMember adds one of the owner's followers to a list
+func AddAudienceListMember(listID, userID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	if err := tx.QueryRow(`SELECT owner_id FROM audience_lists WHERE id = ?`, listID).Scan(&ownerID); err != nil {
+		return notFoundOr(err, "failed to look up audience list")
+	}
+	if err := setAudienceListMembers(tx, listID, ownerID, []int{userID}); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE audience_lists SET updated_at = ? WHERE id = ?`, time.Now(), listID); err != nil {
+		return fmt.Errorf("failed to update audience list: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveAudienceListMember takes a user out of a list. They lose access to
+// the posts shared with the list straight away.
+func RemoveAudienceListMember(listID, userID int) error {
+	res, err := db.DB.Exec(`DELETE FROM audience_list_members WHERE list_id = ? AND user_id = ?`, listID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove audience list member: %w", err)
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if affectedRows == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := db.DB.Exec(`UPDATE audience_lists SET updated_at = ? WHERE id = ?`, time.Now(), listID); err != nil {
+		return fmt.Errorf("failed to update audience list: %w", err)
+	}
+	return nil
+}
+
+func validateListName(name string) error {
+	if name == "" || utf8.RuneCountInString(name) > MaxAudienceListNameLength {
+		return ErrInvalidListName
+	}
+	return nil
+}
+
+// checkListNameFree makes sure ownerID has no other list called name
+func checkListNameFree(tx *sql.Tx, ownerID int, name string, listID int) error {
+	var taken bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM audience_lists WHERE owner_id = ? AND name = ? AND id != ?)`,
+		ownerID, name, listID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to check list name: %w", err)
+	}
+	if taken {
+		return ErrDuplicateListName
+	}
+	return nil
+}
+
+// setAudienceListMembers adds members to a list after checking that each of
+// them follows the owner
+func setAudienceListMembers(tx *sql.Tx, listID, ownerID int, memberIDs []int) error {
+	for _, userID := range memberIDs {
+		isFollower, err := isFollowing(tx, userID, ownerID)
+		if err != nil {
+			return err
+		}
+		if !isFollower {
+			return ErrNotFollower
+		}
+
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO audience_list_members (list_id, user_id) VALUES (?, ?)`,
+			listID, userID); err != nil {
+			return fmt.Errorf("failed to add audience list member: %w", err)
+		}
+	}
+	return nil
+}
+
+// attachAudienceListMembers fills in the members of lists in one query, as
+// the owner of the lists may see them
+func attachAudienceListMembers(lists []models.AudienceList) error {
+	if len(lists) == 0 {
+		return nil
+	}
+
+	index := make(map[int]int, len(lists))
+	args := make([]interface{}, len(lists))
+	for i, list := range lists {
+		lists[i].Members = []models.UserSummary{}
+		index[list.ID] = i
+		args[i] = list.ID
+	}
+
+	rows, err := db.DB.Query(`SELECT `+userSummaryColumns+`, alm.list_id
+		FROM audience_list_members alm JOIN users u ON u.id = alm.user_id
+		WHERE alm.list_id IN (`+placeholders(len(lists))+`)
+		ORDER BY u.first_name, u.last_name, u.id`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to load audience list members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var listID int
+		user, err := scanUserSummary(rows, &listID)
+		if err != nil {
+			return fmt.Errorf("failed to scan audience list member: %w", err)
+		}
+		i := index[listID]
+		lists[i].Members = append(lists[i].Members, user)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating over audience list members: %w", err)
+	}
+
+	var members []*models.UserSummary
+	for i := range lists {
+		for j := range lists[i].Members {
+			members = append(members, &lists[i].Members[j])
+		}
+	}
+	return redactUserSummaries(lists[0].OwnerID, members)
+}
+
+// setPostAudienceLists shares an almost private post with lists of its author
+func setPostAudienceLists(tx *sql.Tx, postID, authorID int, listIDs []int) error {
+	for _, listID := range listIDs {
+		var ownerID int
+		err := tx.QueryRow(`SELECT owner_id FROM audience_lists WHERE id = ?`, listID).Scan(&ownerID)
+		if err == sql.ErrNoRows || (err == nil && ownerID != authorID) {
+			return ErrInvalidAudience
+		} else if err != nil {
+			return fmt.Errorf("failed to look up audience list: %w", err)
+		}
+
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO post_audience_lists (post_id, list_id) VALUES (?, ?)`,
+			postID, listID); err != nil {
+			return fmt.Errorf("failed to share post with audience list: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeFromAudienceLists takes userID out of every list of ownerID, used
+// when they stop following the owner
+func removeFromAudienceLists(tx *sql.Tx, ownerID, userID int) error {
+	_, err := tx.Exec(`DELETE FROM audience_list_members
+		WHERE user_id = ? AND list_id IN (SELECT id FROM audience_lists WHERE owner_id = ?)`, userID, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to remove from audience lists: %w", err)
+	}
+	return nil
+}
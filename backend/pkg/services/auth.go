@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -18,8 +19,22 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 )
 
-// RegisterUser creates a new user in the database
-func RegisterUser(user models.RegisterRequest) error {
+// RegisterUser creates a new user in the database, with the handle they
+// chose. avatar, when not nil, is the uploaded avatar of the user; it goes
+// through the same checks as any other media upload.
+func RegisterUser(user models.RegisterRequest, avatar io.Reader) error {
+	if err := ValidateHandle(user.Handle); err != nil {
+		return err
+	}
+
+	var avatarUpload mediaUpload
+	if avatar != nil {
+		var err error
+		if avatarUpload, err = readMedia(avatar); err != nil {
+			return err
+		}
+	}
+
 	tx, err := db.DB.Begin()
 	if err != nil {
 		return fmt.Errorf("could not start transaction: %w", err)
@@ -34,6 +49,9 @@ func RegisterUser(user models.RegisterRequest) error {
 	} else if err != sql.ErrNoRows {
 		return fmt.Errorf("error checking for existing user: %w", err)
 	}
+	if err := checkHandleAvailable(tx, user.Handle, 0); err != nil {
+		return err
+	}
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
@@ -48,15 +66,16 @@ func RegisterUser(user models.RegisterRequest) error {
 	}
 
 	// Insert the new user
-	_, err = tx.Exec(`INSERT INTO users (email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me,is_private ,created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	res, err := tx.Exec(`INSERT INTO users (handle, email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me,is_private ,created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.Handle,
 		user.Email,
 		hashedPassword,
-		user.FirstName,
-		user.LastName,
+		stripControlChars(user.FirstName),
+		stripControlChars(user.LastName),
 		dateOfBirth,
 		user.Avatar,
-		user.Nickname,
+		stripControlChars(user.Nickname),
 		user.AboutMe,
 		user.IsPrivate,
 		time.Now(),
@@ -66,10 +85,35 @@ func RegisterUser(user models.RegisterRequest) error {
 		return fmt.Errorf("failed to register user: %w", err)
 	}
 
+	// The stored avatar is removed again if registration fails after it
+	var avatarKey string
+	var avatarID int
+	if avatar != nil {
+		userID, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to retrieve user ID: %w", err)
+		}
+		media, err := storeMedia(tx, int(userID), avatarUpload)
+		if err != nil {
+			return err
+		}
+		avatarKey, avatarID = media.StorageKey, media.ID
+		if _, err := tx.Exec(`UPDATE users SET avatar_media_id = ? WHERE id = ?`, media.ID, userID); err != nil {
+			mediaStore.Delete(avatarKey)
+			return fmt.Errorf("failed to set avatar: %w", err)
+		}
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
+		if avatarKey != "" {
+			mediaStore.Delete(avatarKey)
+		}
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
+	if avatarKey != "" {
+		enqueueMedia(avatarID)
+	}
 
 	return nil
 }
@@ -79,9 +123,10 @@ func AuthenticateUser(email, password string) (models.User, error) {
 	var user models.User
 
 	// Retrieve user by email
-	row := db.DB.QueryRow("SELECT id, email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me,is_private ,created_at, updated_at FROM users WHERE email = ?", email)
+	row := db.DB.QueryRow("SELECT id, COALESCE(handle, ''), email, password, first_name, last_name, date_of_birth, avatar, nickname, about_me,is_private ,created_at, updated_at FROM users WHERE email = ?", email)
 	err := row.Scan(
 		&user.ID,
+		&user.Handle,
 		&user.Email,
 		&user.Password,
 		&user.FirstName,
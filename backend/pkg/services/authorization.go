@@ -0,0 +1,386 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrForbidden = errors.New("you are not allowed to perform this action")
+	ErrNotFound  = errors.New("resource not found")
+)
+
+// Action is something a user may try to do on a resource. The comment next
+// to each action names the kind of resource its ID refers to.
+type Action string
+
+const (
+	ActionUpdateProfile Action = "update_profile" // user
+
+	ActionViewPost      Action = "view_post"       // post
+	ActionUpdatePost    Action = "update_post"     // post
+	ActionDeletePost    Action = "delete_post"     // post
+	ActionCommentOnPost Action = "comment_on_post" // post
+	ActionReactToPost   Action = "react_to_post"   // post
+
+	ActionViewComment    Action = "view_comment"     // comment
+	ActionUpdateComment  Action = "update_comment"   // comment
+	ActionDeleteComment  Action = "delete_comment"   // comment
+	ActionReactToComment Action = "react_to_comment" // comment
+
+	ActionReactToMessage Action = "react_to_message" // chat message
+
+	ActionViewGroup             Action = "view_group"               // group
+	ActionViewGroupContent      Action = "view_group_content"       // group
+	ActionViewGroupChat         Action = "view_group_chat"          // group
+	ActionPostToGroup           Action = "post_to_group"            // group
+	ActionJoinGroup             Action = "join_group"               // group
+	ActionInviteToGroup         Action = "invite_to_group"          // group
+	ActionCreateGroupEvent      Action = "create_group_event"       // group
+	ActionRespondToEvent        Action = "respond_to_event"         // group event
+	ActionRespondToInvitation   Action = "respond_to_invitation"    // group invitation
+	ActionRespondToGroupRequest Action = "respond_to_group_request" // group request
+	ActionViewGroupMembers      Action = "view_group_members"       // group
+	ActionViewGroupRequests     Action = "view_group_requests"      // group
+	ActionManageGroupRoles      Action = "manage_group_roles"       // group
+	ActionRemoveGroupMember     Action = "remove_group_member"      // group
+	ActionTransferGroup         Action = "transfer_group"           // group
+	ActionEditGroup             Action = "edit_group"               // group
+	ActionDeleteGroup           Action = "delete_group"             // group
+
+	ActionViewFollowRequest      Action = "view_follow_request"       // follow request
+	ActionRespondToFollowRequest Action = "respond_to_follow_request" // follow request
+	ActionCancelFollowRequest    Action = "cancel_follow_request"     // follow request
+
+	ActionCreateNotification   Action = "create_notification"    // user receiving it
+	ActionMarkNotificationRead Action = "mark_notification_read" // notification
+
+	ActionManageAudienceList Action = "manage_audience_list" // audience list
+
+	ActionViewMedia Action = "view_media" // media
+)
+
+// Authorize is the central authorization policy. It returns nil when userID
+// may perform action on the resource identified by resourceID, ErrForbidden
+// when they may not and ErrNotFound when the resource does not exist or is
+// hidden from them.
+func Authorize(userID int, action Action, resourceID int) error {
+	switch action {
+	case ActionUpdateProfile, ActionCreateNotification:
+		return requireSameUser(userID, resourceID)
+
+	case ActionUpdatePost:
+		authorID, err := lookupOwner(`SELECT user_id FROM posts WHERE id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		return requireSameUser(userID, authorID)
+
+	case ActionDeletePost:
+		var authorID int
+		var groupID sql.NullInt64
+		err := db.DB.QueryRow(`SELECT user_id, group_id FROM posts WHERE id = ?`, resourceID).Scan(&authorID, &groupID)
+		if err != nil {
+			return notFoundOr(err, "failed to look up post")
+		}
+		if authorID == userID {
+			return nil
+		}
+		// Moderators and above may remove the posts of lower ranked members
+		// and of former members from their group
+		if groupID.Valid {
+			return requireGroupOutranks(userID, int(groupID.Int64), authorID, PermRemovePosts)
+		}
+		return ErrForbidden
+
+	case ActionViewPost, ActionCommentOnPost, ActionReactToPost:
+		return requireVisiblePost(userID, resourceID)
+
+	case ActionViewComment, ActionUpdateComment, ActionDeleteComment:
+		var authorID, postID int
+		err := db.DB.QueryRow(`SELECT user_id, post_id FROM comments WHERE id = ?`, resourceID).Scan(&authorID, &postID)
+		if err != nil {
+			return notFoundOr(err, "failed to look up comment")
+		}
+		if err := requireVisiblePost(userID, postID); err != nil {
+			return err
+		}
+		if err := requireNotBlocked(userID, authorID); err != nil {
+			return err
+		}
+		if action == ActionViewComment || authorID == userID {
+			return nil
+		}
+		// Authors of a post may remove the comments left on it
+		if action == ActionDeleteComment {
+			postAuthorID, err := lookupOwner(`SELECT user_id FROM posts WHERE id = ?`, postID)
+			if err != nil {
+				return err
+			}
+			return requireSameUser(userID, postAuthorID)
+		}
+		return ErrForbidden
+
+	case ActionReactToComment:
+		var authorID, postID int
+		var deleted bool
+		err := db.DB.QueryRow(`SELECT user_id, post_id, deleted_at IS NOT NULL FROM comments WHERE id = ?`,
+			resourceID).Scan(&authorID, &postID, &deleted)
+		if err != nil {
+			return notFoundOr(err, "failed to look up comment")
+		}
+		if deleted {
+			return ErrNotFound
+		}
+		if err := requireNotBlocked(userID, authorID); err != nil {
+			return err
+		}
+		return requireVisiblePost(userID, postID)
+
+	case ActionReactToMessage:
+		// Only the people taking part in a conversation see its messages
+		var senderID, groupID int
+		var recipientID sql.NullInt64
+		var isGroup bool
+		err := db.DB.QueryRow(`SELECT sender_id, recipient_id, COALESCE(group_id, 0), is_group FROM chats WHERE id = ?`,
+			resourceID).Scan(&senderID, &recipientID, &groupID, &isGroup)
+		if err != nil {
+			return notFoundOr(err, "failed to look up message")
+		}
+		if isGroup {
+			isMember, err := IsGroupMember(groupID, userID)
+			if err != nil {
+				return err
+			}
+			if !isMember {
+				return ErrNotFound
+			}
+			return nil
+		}
+		if userID != senderID && (!recipientID.Valid || int(recipientID.Int64) != userID) {
+			return ErrNotFound
+		}
+		return nil
+
+	case ActionViewGroup, ActionJoinGroup:
+		return requireVisibleGroup(userID, resourceID)
+
+	case ActionViewGroupContent, ActionViewGroupMembers:
+		return requireGroupContent(userID, resourceID)
+
+	case ActionViewGroupChat, ActionPostToGroup:
+		// Whatever the visibility of the group, only members take part in it
+		return requireGroupMember(userID, resourceID)
+
+	case ActionInviteToGroup, ActionViewGroupRequests, ActionCreateGroupEvent, ActionManageGroupRoles, ActionRemoveGroupMember,
+		ActionTransferGroup, ActionEditGroup, ActionDeleteGroup:
+		return requireGroupPermission(userID, resourceID, groupActionPermissions[action])
+
+	case ActionRespondToEvent:
+		groupID, err := lookupOwner(`SELECT group_id FROM group_events WHERE id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		return requireGroupMember(userID, groupID)
+
+	case ActionRespondToInvitation:
+		inviteeID, err := lookupOwner(`SELECT invitee_id FROM group_invitations WHERE id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		return requireSameUser(userID, inviteeID)
+
+	case ActionRespondToGroupRequest:
+		groupID, err := lookupOwner(`SELECT group_id FROM group_requests WHERE id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		return requireGroupPermission(userID, groupID, PermApproveRequests)
+
+	case ActionViewFollowRequest, ActionRespondToFollowRequest, ActionCancelFollowRequest:
+		var senderID, recipientID int
+		err := db.DB.QueryRow(`SELECT sender_id, recipient_id FROM follow_requests WHERE id = ?`, resourceID).Scan(&senderID, &recipientID)
+		if err != nil {
+			return notFoundOr(err, "failed to look up follow request")
+		}
+		switch {
+		case action == ActionViewFollowRequest && (userID == senderID || userID == recipientID):
+			return nil
+		case action == ActionRespondToFollowRequest && userID == recipientID:
+			return nil
+		case action == ActionCancelFollowRequest && userID == senderID:
+			return nil
+		}
+		return ErrForbidden
+
+	case ActionMarkNotificationRead:
+		ownerID, err := lookupOwner(`SELECT user_id FROM notifications WHERE id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		return requireSameUser(userID, ownerID)
+
+	case ActionManageAudienceList:
+		// Lists are private to their owner, so other users are told they do not exist
+		ownerID, err := lookupOwner(`SELECT owner_id FROM audience_lists WHERE id = ?`, resourceID)
+		if err != nil {
+			return err
+		}
+		if ownerID != userID {
+			return ErrNotFound
+		}
+		return nil
+
+	case ActionViewMedia:
+		return requireVisibleMedia(userID, resourceID)
+	}
+
+	return fmt.Errorf("unknown action %q", action)
+}
+
+func requireSameUser(userID, ownerID int) error {
+	if userID != ownerID {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// requireVisiblePost hides posts the user cannot see behind ErrNotFound
+func requireVisiblePost(userID, postID int) error {
+	visible, args := postVisibilityCondition(userID)
+	var exists bool
+	err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = ? AND `+visible+`)`,
+		append([]interface{}{postID}, args...)...).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check post visibility: %w", err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// requireNotBlocked hides the things of users who blocked userID, or whom
+// userID blocked, behind ErrNotFound
+func requireNotBlocked(userID, otherID int) error {
+	blocked, err := IsBlocked(userID, otherID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// groupActionPermissions maps the group actions to the permission a member needs
+var groupActionPermissions = map[Action]GroupPermission{
+	ActionInviteToGroup:     PermInviteMembers,
+	ActionViewGroupRequests: PermApproveRequests,
+	ActionCreateGroupEvent:  PermCreateEvents,
+	ActionManageGroupRoles:  PermManageRoles,
+	ActionRemoveGroupMember: PermRemoveMembers,
+	ActionTransferGroup:     PermTransferGroup,
+	ActionEditGroup:         PermEditGroup,
+	ActionDeleteGroup:       PermDeleteGroup,
+}
+
+// requireVisibleGroup hides the groups the user may not know of, such as
+// secret groups they were not invited to, behind ErrNotFound
+func requireVisibleGroup(userID, groupID int) error {
+	visible, args := groupVisibilityCondition(userID)
+	var isVisible bool
+	err := db.DB.QueryRow(`SELECT `+visible+` FROM groups g WHERE g.id = ?`, append(args, groupID)...).Scan(&isVisible)
+	if err != nil {
+		return notFoundOr(err, "failed to check group visibility")
+	}
+	if !isVisible {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// requireGroupContent lets through the users who may see the content of a
+// group: everyone for public groups and members only for the others
+func requireGroupContent(userID, groupID int) error {
+	visible, visibleArgs := groupVisibilityCondition(userID)
+	content, contentArgs := groupContentCondition(userID)
+	var isVisible, hasContent bool
+	err := db.DB.QueryRow(`SELECT `+visible+`, `+content+` FROM groups g WHERE g.id = ?`,
+		append(append(visibleArgs, contentArgs...), groupID)...).Scan(&isVisible, &hasContent)
+	if err != nil {
+		return notFoundOr(err, "failed to check group visibility")
+	}
+	if !isVisible {
+		return ErrNotFound
+	}
+	if !hasContent {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// requireGroupMember lets through the current members of a group
+func requireGroupMember(userID, groupID int) error {
+	if err := requireVisibleGroup(userID, groupID); err != nil {
+		return err
+	}
+	isMember, err := IsGroupMember(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// requireGroupPermission lets through the members whose role grants the permission
+func requireGroupPermission(userID, groupID int, permission GroupPermission) error {
+	if err := requireVisibleGroup(userID, groupID); err != nil {
+		return err
+	}
+	allowed, err := HasGroupPermission(groupID, userID, permission)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// requireGroupOutranks lets through the members whose role grants the
+// permission and ranks above the current role of otherID, if any
+func requireGroupOutranks(userID, groupID, otherID int, permission GroupPermission) error {
+	role, err := GetGroupRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	otherRole, err := GetGroupRole(groupID, otherID)
+	if err != nil {
+		return err
+	}
+	if !RoleHasPermission(role, permission) || groupRoleRanks[role] <= groupRoleRanks[otherRole] {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// lookupOwner runs a query selecting a single user or resource ID
+func lookupOwner(query string, resourceID int) (int, error) {
+	var id int
+	if err := db.DB.QueryRow(query, resourceID).Scan(&id); err != nil {
+		return 0, notFoundOr(err, "failed to look up resource")
+	}
+	return id, nil
+}
+
+func notFoundOr(err error, message string) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrBlockSelf   = errors.New("you cannot block yourself")
+	ErrNotBlocked  = errors.New("user is not blocked")
+	ErrUserBlocked = errors.New("you cannot interact with this user")
+)
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// blockCondition returns an SQL condition that only holds when the user in
+// userColumn and viewerID have not blocked each other, with its arguments
+func blockCondition(viewerID int, userColumn string) (string, []interface{}) {
+	condition := `NOT EXISTS (SELECT 1 FROM blocks b
+		WHERE (b.blocker_id = ? AND b.blocked_id = ` + userColumn + `)
+			OR (b.blocker_id = ` + userColumn + ` AND b.blocked_id = ?))`
+	return condition, []interface{}{viewerID, viewerID}
+}
+
+// IsBlocked reports whether either user has blocked the other
+func IsBlocked(userID, otherID int) (bool, error) {
+	return isBlocked(db.DB, userID, otherID)
+}
+
+func isBlocked(q queryRower, userID, otherID int) (bool, error) {
+	var blocked bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM blocks
+		WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		userID, otherID, otherID, userID).Scan(&blocked)
+	if err != nil {
+		return false, fmt.Errorf("failed to check block: %w", err)
+	}
+	return blocked, nil
+}
+
+// BlockUser makes blockerID block blockedID. The two users stop following
+// each other and their pending follow requests and group invitations to
+// each other are dropped.
+func BlockUser(blockerID, blockedID int) error {
+	if blockerID == blockedID {
+		return ErrBlockSelf
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userExists bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, blockedID).Scan(&userExists); err != nil {
+		return fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !userExists {
+		return ErrUserNotFound
+	}
+
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO blocks (blocker_id, blocked_id, created_at) VALUES (?, ?, ?)`,
+		blockerID, blockedID, time.Now()); err != nil {
+		return fmt.Errorf("failed to block user: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM followers
+		WHERE (follower_id = ? AND followed_id = ?) OR (follower_id = ? AND followed_id = ?)`,
+		blockerID, blockedID, blockedID, blockerID); err != nil {
+		return fmt.Errorf("failed to remove follows: %w", err)
+	}
+	if err := removeFromAudienceLists(tx, blockerID, blockedID); err != nil {
+		return err
+	}
+	if err := removeFromAudienceLists(tx, blockedID, blockerID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM follow_requests
+		WHERE ((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?)) AND status = ?`,
+		blockerID, blockedID, blockedID, blockerID, models.FollowRequestPending); err != nil {
+		return fmt.Errorf("failed to remove follow requests: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE group_invitations SET status = ?, responded_at = ?
+		WHERE ((inviter_id = ? AND invitee_id = ?) OR (inviter_id = ? AND invitee_id = ?)) AND status = ?`,
+		models.GroupStatusRejected, time.Now(), blockerID, blockedID, blockedID, blockerID, models.GroupStatusPending); err != nil {
+		return fmt.Errorf("failed to reject group invitations: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// UnblockUser lifts the block of blockerID on blockedID. Follows removed by
+// the block are not restored.
+func UnblockUser(blockerID, blockedID int) error {
+	res, err := db.DB.Exec(`DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ?`, blockerID, blockedID)
+	if err != nil {
+		return fmt.Errorf("failed to unblock user: %w", err)
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if affectedRows == 0 {
+		return ErrNotBlocked
+	}
+	return nil
+}
+
+// ListBlockedUsers returns the users blocked by userID, most recently blocked first
+func ListBlockedUsers(userID int) ([]models.UserSummary, error) {
+	rows, err := db.DB.Query(`SELECT `+userSummaryColumns+`
+		FROM blocks b JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ?
+		ORDER BY b.created_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocked users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.UserSummary
+	for rows.Next() {
+		user, err := scanUserSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan blocked user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over blocked users: %w", err)
+	}
+
+	// Blocking removes follows, so only nicknames shown to everyone remain
+	if err := redactUserSummaryList(userID, users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
@@ -3,23 +3,46 @@ package services
 import (
 	"Social/pkg/db"
 	"Social/pkg/models"
+	"database/sql"
 	"fmt"
 	"log"
 )
 
-func SendMessage(message models.Chat) error {
+// SendMessage stores a chat message and returns its ID. Direct messages
+// between users who blocked each other are refused with ErrUserBlocked, and
+// attached media must have been uploaded by the sender.
+func SendMessage(message models.Chat) (int, error) {
 	log.Printf("Sending message: %+v", message)
 
+	if !message.IsGroup {
+		blocked, err := IsBlocked(message.SenderID, message.RecipientID)
+		if err != nil {
+			return 0, err
+		}
+		if blocked {
+			return 0, ErrUserBlocked
+		}
+	}
+
+	if err := checkMediaOwner(db.DB, message.SenderID, message.MediaID); err != nil {
+		return 0, err
+	}
+
 	query := `
-		INSERT INTO chats (sender_id, recipient_id, group_id, message, is_group, created_at) 
-		VALUES (?, ?, ?, ?, ?, ?)`
+		INSERT INTO chats (sender_id, recipient_id, group_id, message, is_group, created_at, media_id) 
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := db.DB.Exec(query, message.SenderID, message.RecipientID, message.GroupID, message.Message, message.IsGroup, message.CreatedAt)
+	res, err := db.DB.Exec(query, message.SenderID, message.RecipientID, message.GroupID, message.Message, message.IsGroup, message.CreatedAt, message.MediaID)
 	if err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+		return 0, fmt.Errorf("failed to send message: %w", err)
 	}
 
-	return nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve message ID: %w", err)
+	}
+
+	return int(id), nil
 }
 
 func GetMessages(userID, recipientID int, groupID int) ([]models.Chat, error) {
@@ -27,7 +50,7 @@ func GetMessages(userID, recipientID int, groupID int) ([]models.Chat, error) {
 
 	var messages []models.Chat
 	query := `
-		SELECT id, sender_id, recipient_id, group_id, message, is_group, created_at
+		SELECT id, sender_id, recipient_id, group_id, message, is_group, created_at, media_id
 		FROM chats
 		WHERE
 			(sender_id = ? AND recipient_id = ?)
@@ -43,10 +66,12 @@ func GetMessages(userID, recipientID int, groupID int) ([]models.Chat, error) {
 
 	for rows.Next() {
 		var msg models.Chat
-		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.RecipientID, &msg.GroupID, &msg.Message, &msg.IsGroup, &msg.CreatedAt)
+		var mediaID sql.NullInt64
+		err := rows.Scan(&msg.ID, &msg.SenderID, &msg.RecipientID, &msg.GroupID, &msg.Message, &msg.IsGroup, &msg.CreatedAt, &mediaID)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
+		msg.MediaID = nullableID(mediaID)
 		messages = append(messages, msg)
 	}
 
@@ -54,5 +79,18 @@ func GetMessages(userID, recipientID int, groupID int) ([]models.Chat, error) {
 		return nil, fmt.Errorf("error occurred while iterating rows: %w", err)
 	}
 
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	counts, viewerReactions, err := loadReactions(userID, models.ReactionTargetMessage, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range messages {
+		messages[i].Reactions = counts[messages[i].ID]
+		messages[i].ViewerReaction = viewerReactions[messages[i].ID]
+	}
+
 	return messages, nil
 }
@@ -4,91 +4,468 @@ import (
 	"Social/pkg/db"
 	"Social/pkg/models"
 	"database/sql"
+	"errors"
 	"fmt"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
-// GetComment retrieves a specific comment
-func GetComment(commentID int) (models.Comment, error) {
+const (
+	// DefaultMaxCommentDepth is the deepest level replies may reach when
+	// COMMENT_MAX_DEPTH is not set. Top-level comments are at depth 0.
+	DefaultMaxCommentDepth = 5
+
+	DefaultCommentLimit = 20
+	MaxCommentLimit     = 100
+
+	CommentModeTree = "tree"
+	CommentModeFlat = "flat"
+)
+
+var (
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrInvalidParentComment = errors.New("the comment replied to is not on this post or was deleted")
+	ErrCommentTooDeep       = errors.New("this thread cannot be nested any deeper")
+	ErrInvalidCommentMode   = errors.New("mode must be tree or flat")
+)
+
+// commentColumns selects a comment aliased as c in the order scanComment
+// expects. Tombstones do not reveal their author.
+const commentColumns = `c.id, CASE WHEN c.deleted_at IS NULL THEN c.user_id ELSE 0 END, c.post_id, c.content,
+	c.created_at, c.updated_at, c.parent_id, c.depth, c.deleted_at IS NOT NULL, c.media_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanComment(row rowScanner, extra ...interface{}) (models.Comment, error) {
 	var comment models.Comment
+	var parentID, mediaID sql.NullInt64
+	dest := []interface{}{&comment.ID, &comment.UserID, &comment.PostID, &comment.Content,
+		&comment.CreatedAt, &comment.UpdatedAt, &parentID, &comment.Depth, &comment.Deleted, &mediaID}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return comment, err
+	}
+	comment.MediaID = nullableID(mediaID)
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentID = &id
+	}
+	return comment, nil
+}
 
-	query := `
-		SELECT id, user_id, post_id, content, created_at, updated_at
-		FROM comments
-		WHERE id = ?`
+// MaxCommentDepth returns the deepest level replies may reach, read from the
+// COMMENT_MAX_DEPTH environment variable
+func MaxCommentDepth() int {
+	if depth, err := strconv.Atoi(os.Getenv("COMMENT_MAX_DEPTH")); err == nil && depth >= 0 {
+		return depth
+	}
+	return DefaultMaxCommentDepth
+}
 
-	row := db.DB.QueryRow(query, commentID)
-	err := row.Scan(&comment.ID, &comment.UserID, &comment.PostID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt)
+// GetComment retrieves a specific comment as seen by viewerID
+func GetComment(viewerID, commentID int) (models.Comment, error) {
+	visible, args := commentVisibilityCondition(viewerID)
+	row := db.DB.QueryRow(`SELECT `+commentColumns+` FROM comments c WHERE c.id = ? AND `+visible,
+		append([]interface{}{commentID}, args...)...)
+	comment, err := scanComment(row)
 	if err == sql.ErrNoRows {
-		return comment, fmt.Errorf("comment not found")
+		return comment, ErrCommentNotFound
 	} else if err != nil {
 		return comment, fmt.Errorf("failed to retrieve comment: %w", err)
 	}
 
-	return comment, nil
+	comments := []models.Comment{comment}
+	if err := attachCommentReactions(viewerID, comments); err != nil {
+		return comment, err
+	}
+	if err := attachCommentAuthors(viewerID, comments); err != nil {
+		return comment, err
+	}
+
+	return comments[0], nil
 }
 
-// CreateComment adds a new comment to a post
-func CreateComment(comment models.Comment) error {
+// CreateComment adds a new comment to a post, or a reply to another comment
+// of the post when ParentID is set, and returns its ID. The image of the
+// comment, if any, must be a media uploaded by its author.
+func CreateComment(comment models.Comment) (int, error) {
 	// Optional: Check if the comment already exists
-	row := db.DB.QueryRow(`SELECT 1 FROM comments WHERE user_id = ? AND post_id = ? AND content = ?`,
+	row := db.DB.QueryRow(`SELECT 1 FROM comments WHERE user_id = ? AND post_id = ? AND content = ? AND deleted_at IS NULL`,
 		comment.UserID, comment.PostID, comment.Content)
 	var exists int
 	err := row.Scan(&exists)
 	if err == nil {
-		return fmt.Errorf("duplicate comment detected")
+		return 0, fmt.Errorf("duplicate comment detected")
 	}
 	if err != sql.ErrNoRows {
-		return fmt.Errorf("failed to check comment existence: %w", err)
+		return 0, fmt.Errorf("failed to check comment existence: %w", err)
+	}
+
+	comment.Depth = 0
+	if comment.ParentID != nil {
+		var parentPostID, parentDepth int
+		var parentDeleted bool
+		visible, args := commentVisibilityCondition(comment.UserID)
+		err := db.DB.QueryRow(`SELECT c.post_id, c.depth, c.deleted_at IS NOT NULL FROM comments c WHERE c.id = ? AND `+visible,
+			append([]interface{}{*comment.ParentID}, args...)...).Scan(&parentPostID, &parentDepth, &parentDeleted)
+		if err == sql.ErrNoRows || (err == nil && (parentPostID != comment.PostID || parentDeleted)) {
+			return 0, ErrInvalidParentComment
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to look up parent comment: %w", err)
+		}
+
+		comment.Depth = parentDepth + 1
+		if comment.Depth > MaxCommentDepth() {
+			return 0, ErrCommentTooDeep
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkMediaOwner(tx, comment.UserID, comment.MediaID); err != nil {
+		return 0, err
 	}
 
 	// Add the comment if it does not exist
-	_, err = db.DB.Exec(`INSERT INTO comments (user_id, post_id, content, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?)`,
-		comment.UserID, comment.PostID, comment.Content, time.Now(), time.Now())
+	now := time.Now()
+	res, err := tx.Exec(`INSERT INTO comments (user_id, post_id, content, created_at, updated_at, parent_id, depth, media_id) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		comment.UserID, comment.PostID, comment.Content, now, now, comment.ParentID, comment.Depth, comment.MediaID)
 	if err != nil {
-		return fmt.Errorf("failed to create comment: %w", err)
+		return 0, fmt.Errorf("failed to create comment: %w", err)
 	}
-	return nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve comment ID: %w", err)
+	}
+	if err := adjustCommentCount(tx, comment.PostID, 1); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(id), nil
 }
 
 // UpdateComment updates a comment
 func UpdateComment(commentID int, updatedComment models.Comment) error {
-	// Check if the comment exists before updating
-	row := db.DB.QueryRow(`SELECT 1 FROM comments WHERE id = ?`, commentID)
-	var exists int
-	err := row.Scan(&exists)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("comment not found")
-	}
+	// Tombstones cannot be edited back to life
+	res, err := db.DB.Exec(`UPDATE comments SET content = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		updatedComment.Content, time.Now(), commentID)
 	if err != nil {
-		return fmt.Errorf("failed to check comment existence: %w", err)
+		return fmt.Errorf("failed to update comment: %w", err)
 	}
 
-	_, err = db.DB.Exec(`UPDATE comments SET content = ?, updated_at = ? WHERE id = ?`,
-		updatedComment.Content, time.Now(), commentID)
+	affectedRows, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to update comment: %w", err)
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if affectedRows == 0 {
+		return ErrCommentNotFound
 	}
 	return nil
 }
 
-// DeleteComment removes a comment from a post
+// DeleteComment removes a comment from a post. A comment that has replies is
+// replaced by a tombstone so that its replies keep their place in the thread,
+// and tombstones left without replies are removed along the way.
 func DeleteComment(commentID int) error {
-	// Check if the comment exists before deleting
-	row := db.DB.QueryRow(`SELECT 1 FROM comments WHERE id = ?`, commentID)
-	var exists int
-	err := row.Scan(&exists)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("comment not found")
-	}
+	tx, err := db.DB.Begin()
 	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var postID int
+	var deleted bool
+	err = tx.QueryRow(`SELECT post_id, deleted_at IS NOT NULL FROM comments WHERE id = ?`, commentID).Scan(&postID, &deleted)
+	if err == sql.ErrNoRows || deleted {
+		return ErrCommentNotFound
+	} else if err != nil {
 		return fmt.Errorf("failed to check comment existence: %w", err)
 	}
+	// Tombstones are not counted, so only the comment itself leaves the count
+	if err := adjustCommentCount(tx, postID, -1); err != nil {
+		return err
+	}
 
-	_, err = db.DB.Exec(`DELETE FROM comments WHERE id = ?`, commentID)
-	if err != nil {
-		return fmt.Errorf("failed to delete comment: %w", err)
+	for id := commentID; ; {
+		var hasReplies bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM comments WHERE parent_id = ?)`, id).Scan(&hasReplies); err != nil {
+			return fmt.Errorf("failed to check comment replies: %w", err)
+		}
+		if err := deleteReactions(tx, models.ReactionTargetComment, id); err != nil {
+			return err
+		}
+		if hasReplies {
+			if _, err := tx.Exec(`UPDATE comments SET content = '', media_id = NULL, deleted_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+				return fmt.Errorf("failed to delete comment: %w", err)
+			}
+			break
+		}
+
+		var parentID sql.NullInt64
+		if err := tx.QueryRow(`SELECT parent_id FROM comments WHERE id = ?`, id).Scan(&parentID); err != nil {
+			return fmt.Errorf("failed to look up parent comment: %w", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM comments WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+
+		// Carry on with the parent if it was a tombstone kept only for this reply
+		if !parentID.Valid {
+			break
+		}
+		var parentDeleted bool
+		if err := tx.QueryRow(`SELECT deleted_at IS NOT NULL FROM comments WHERE id = ?`, parentID.Int64).Scan(&parentDeleted); err != nil {
+			return fmt.Errorf("failed to look up parent comment: %w", err)
+		}
+		if !parentDeleted {
+			break
+		}
+		id = int(parentID.Int64)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
+
+// GetPostComments returns one page of the comments of a post as seen by
+// viewerID, oldest threads first. In tree mode a page holds top-level comments with all their
+// replies nested under them; in flat mode it holds comments in thread order,
+// each reply following its parent, with their depth. Comments of muted users
+// and comments mentioning muted keywords are left out with their replies.
+func GetPostComments(viewerID, postID int, mode, cursor string, limit int) (models.CommentPage, error) {
+	var page models.CommentPage
+
+	if limit <= 0 {
+		limit = DefaultCommentLimit
+	} else if limit > MaxCommentLimit {
+		limit = MaxCommentLimit
+	}
+
+	after := ""
+	if cursor != "" {
+		var err error
+		if after, err = decodeKeyCursor(cursor, validCommentPath); err != nil {
+			return page, err
+		}
+	}
+
+	switch mode {
+	case "", CommentModeTree:
+		return getCommentTree(viewerID, postID, after, limit)
+	case CommentModeFlat:
+		return getFlatComments(viewerID, postID, after, limit)
+	}
+	return page, ErrInvalidCommentMode
+}
+
+// commentVisibilityCondition returns an SQL condition over comments aliased
+// as c that hides from viewerID the comments of users who blocked them or
+// were blocked by them, with its arguments. Tombstones stay, as they show
+// nothing of their author.
+func commentVisibilityCondition(viewerID int) (string, []interface{}) {
+	notBlocked, args := blockCondition(viewerID, "c.user_id")
+	return `(c.deleted_at IS NOT NULL OR ` + notBlocked + `)`, args
+}
+
+// commentThreadQuery walks the threads of a post from the top-level comments
+// matching rootCondition, giving each comment its path: the zero-padded IDs
+// of its ancestors and itself. Sorting by path lists replies after their parent.
+// Comments hidden from viewerID or muted by them are left out along with their
+// replies. It returns the query with the arguments of the thread, to which the
+// caller appends its own.
+func commentThreadQuery(viewerID, postID int, mutes muteFilter, rootCondition string, rootArgs ...interface{}) (string, []interface{}) {
+	visible, visibleArgs := commentVisibilityCondition(viewerID)
+	notMuted, mutedArgs := mutes.commentCondition()
+	visible += ` AND ` + notMuted
+	visibleArgs = append(visibleArgs, mutedArgs...)
+	query := `
+	WITH RECURSIVE thread(id, path) AS (
+		SELECT c.id, printf('%010d', c.id) FROM comments c
+		WHERE c.post_id = ? AND c.parent_id IS NULL AND ` + rootCondition + ` AND ` + visible + `
+		UNION ALL
+		SELECT c.id, t.path || '/' || printf('%010d', c.id) FROM comments c JOIN thread t ON c.parent_id = t.id
+		WHERE ` + visible + `
+	)
+	SELECT ` + commentColumns + `, t.path
+	FROM thread t
+	JOIN comments c ON c.id = t.id`
+
+	args := append([]interface{}{postID}, rootArgs...)
+	args = append(args, visibleArgs...)
+	args = append(args, visibleArgs...)
+	return query, args
+}
+
+func getFlatComments(viewerID, postID int, after string, limit int) (models.CommentPage, error) {
+	var page models.CommentPage
+
+	mutes, err := loadMuteFilter(viewerID)
+	if err != nil {
+		return page, err
+	}
+
+	// Fetch one extra comment to know whether there is a next page
+	query, args := commentThreadQuery(viewerID, postID, mutes, "1")
+	rows, err := db.DB.Query(query+`
+	WHERE t.path > ?
+	ORDER BY t.path
+	LIMIT ?`, append(args, after, limit+1)...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query comments: %w", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		comment, err := scanComment(rows, &path)
+		if err != nil {
+			return page, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		page.Comments = append(page.Comments, comment)
+		paths = append(paths, path)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error iterating over comments: %w", err)
+	}
+
+	if len(page.Comments) > limit {
+		page.Comments = page.Comments[:limit]
+		page.NextCursor = encodeKeyCursor(paths[limit-1])
+	}
+
+	if err := attachCommentReactions(viewerID, page.Comments); err != nil {
+		return page, err
+	}
+	if err := attachCommentAuthors(viewerID, page.Comments); err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+func getCommentTree(viewerID, postID int, after string, limit int) (models.CommentPage, error) {
+	var page models.CommentPage
+
+	// The cursor of a tree page is the path of its last top-level comment
+	afterID := 0
+	if after != "" {
+		if strings.Contains(after, "/") {
+			return page, ErrInvalidCursor
+		}
+		afterID, _ = strconv.Atoi(after)
+	}
+
+	mutes, err := loadMuteFilter(viewerID)
+	if err != nil {
+		return page, err
+	}
+
+	var rootIDs []int
+	visible, visibleArgs := commentVisibilityCondition(viewerID)
+	notMuted, mutedArgs := mutes.commentCondition()
+	args := append([]interface{}{postID, afterID}, visibleArgs...)
+	args = append(args, mutedArgs...)
+	rows, err := db.DB.Query(`SELECT c.id FROM comments c WHERE c.post_id = ? AND c.parent_id IS NULL AND c.id > ? AND `+visible+`
+		AND `+notMuted+` ORDER BY c.id LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query comments: %w", err)
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return page, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		rootIDs = append(rootIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error iterating over comments: %w", err)
+	}
+	if len(rootIDs) == 0 {
+		return page, nil
+	}
+
+	if len(rootIDs) > limit {
+		rootIDs = rootIDs[:limit]
+		page.NextCursor = encodeKeyCursor(fmt.Sprintf("%010d", rootIDs[limit-1]))
+	}
+
+	// Load the whole threads of the page at once
+	query, args := commentThreadQuery(viewerID, postID, mutes, "c.id > ? AND c.id <= ?", afterID, rootIDs[len(rootIDs)-1])
+	rows, err = db.DB.Query(query+`
+	ORDER BY t.path`, args...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query comment threads: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		var path string
+		comment, err := scanComment(rows, &path)
+		if err != nil {
+			return page, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error iterating over comment threads: %w", err)
+	}
+
+	if err := attachCommentReactions(viewerID, comments); err != nil {
+		return page, err
+	}
+	if err := attachCommentAuthors(viewerID, comments); err != nil {
+		return page, err
+	}
+
+	var roots []models.Comment
+	replies := make(map[int][]models.Comment)
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else {
+			replies[*comment.ParentID] = append(replies[*comment.ParentID], comment)
+		}
+	}
+
+	for _, root := range roots {
+		page.Comments = append(page.Comments, nestReplies(root, replies))
+	}
+	return page, nil
+}
+
+// nestReplies attaches to comment its replies, and to them theirs
+func nestReplies(comment models.Comment, replies map[int][]models.Comment) models.Comment {
+	for _, reply := range replies[comment.ID] {
+		comment.Replies = append(comment.Replies, nestReplies(reply, replies))
+	}
+	return comment
+}
+
+// validCommentPath checks that a cursor holds a path built by commentThreadQuery
+func validCommentPath(path string) bool {
+	for _, id := range strings.Split(path, "/") {
+		if len(id) != 10 {
+			return false
+		}
+		if _, err := strconv.Atoi(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultConnectionLimit = 20
+	MaxConnectionLimit     = 100
+)
+
+// Kinds of connection lists of a profile
+const (
+	ConnectionFollowers = "followers"
+	ConnectionFollowing = "following"
+	ConnectionMutual    = "mutual"
+)
+
+var (
+	ErrProfileNotFound   = errors.New("profile not found")
+	ErrPrivateProfile    = errors.New("profile is private and you are not a follower")
+	ErrInvalidConnection = errors.New("connection list must be followers, following or mutual")
+)
+
+// checkProfileAccess returns nil when viewerID may see the full profile of
+// userID: it exists, neither blocked the other, and it is public, their own
+// or followed by them
+func checkProfileAccess(viewerID, userID int) error {
+	var isPrivate bool
+	err := db.DB.QueryRow(`SELECT is_private FROM users WHERE id = ?`, userID).Scan(&isPrivate)
+	if err == sql.ErrNoRows {
+		return ErrProfileNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to get profile: %w", err)
+	}
+
+	blocked, err := IsBlocked(viewerID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrProfileNotFound
+	}
+
+	if isPrivate && viewerID != userID {
+		var follows bool
+		err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ?)`,
+			viewerID, userID).Scan(&follows)
+		if err != nil {
+			return fmt.Errorf("failed to check follow status: %w", err)
+		}
+		if !follows {
+			return ErrPrivateProfile
+		}
+	}
+	return nil
+}
+
+// countConnections returns how many followers userID has and how many users they follow
+func countConnections(userID int) (followers, following int, err error) {
+	err = db.DB.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM followers WHERE followed_id = ?),
+		(SELECT COUNT(*) FROM followers WHERE follower_id = ?)`, userID, userID).Scan(&followers, &following)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count connections: %w", err)
+	}
+	return followers, following, nil
+}
+
+// ListConnections returns a page of the followers of userID, the users they
+// follow, or their followers whom viewerID follows too (mutual). search keeps
+// the users whose name or nickname contains it. Users blocked by or blocking
+// the viewer are left out. Each user is marked with whether the viewer
+// follows them and whether they follow the viewer.
+func ListConnections(viewerID, userID int, kind, search, cursor string, limit int) (models.ConnectionPage, error) {
+	page := models.ConnectionPage{Users: []models.Connection{}}
+
+	if limit <= 0 {
+		limit = DefaultConnectionLimit
+	} else if limit > MaxConnectionLimit {
+		limit = MaxConnectionLimit
+	}
+
+	afterID := 0
+	if cursor != "" {
+		after, err := decodeKeyCursor(cursor, validUserIDKey)
+		if err != nil {
+			return page, err
+		}
+		afterID, _ = strconv.Atoi(after)
+	}
+
+	var query string
+	switch kind {
+	case ConnectionFollowers, ConnectionMutual:
+		query = `FROM followers f JOIN users u ON u.id = f.follower_id WHERE f.followed_id = ?`
+	case ConnectionFollowing:
+		query = `FROM followers f JOIN users u ON u.id = f.followed_id WHERE f.follower_id = ?`
+	default:
+		return page, ErrInvalidConnection
+	}
+
+	if err := checkProfileAccess(viewerID, userID); err != nil {
+		return page, err
+	}
+
+	notBlocked, blockArgs := blockCondition(viewerID, "u.id")
+	args := append([]interface{}{viewerID, viewerID, userID, afterID}, blockArgs...)
+	query += ` AND u.id > ? AND ` + notBlocked
+	if kind == ConnectionMutual {
+		query += ` AND EXISTS (SELECT 1 FROM followers vf WHERE vf.follower_id = ? AND vf.followed_id = u.id)`
+		args = append(args, viewerID)
+	}
+	if search = strings.TrimSpace(search); search != "" {
+		// Hidden nicknames must not be searchable either
+		pattern := "%" + escapeLike(search) + "%"
+		nicknameVisible, nicknameArgs := visibleFieldCondition(viewerID, "u.nickname_visibility", "u.id")
+		query += ` AND (COALESCE(u.first_name, '') || ' ' || COALESCE(u.last_name, '') LIKE ? ESCAPE '\'
+			OR (COALESCE(u.nickname, '') LIKE ? ESCAPE '\' AND ` + nicknameVisible + `))`
+		args = append(append(args, pattern, pattern), nicknameArgs...)
+	}
+
+	rows, err := db.DB.Query(`SELECT `+userSummaryColumns+`,
+		EXISTS (SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = u.id),
+		EXISTS (SELECT 1 FROM followers WHERE follower_id = u.id AND followed_id = ?)
+		`+query+` ORDER BY u.id LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query connections: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var connection models.Connection
+		connection.UserSummary, err = scanUserSummary(rows, &connection.ViewerFollows, &connection.FollowsViewer)
+		if err != nil {
+			return page, fmt.Errorf("failed to scan connection: %w", err)
+		}
+		page.Users = append(page.Users, connection)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error iterating over connections: %w", err)
+	}
+
+	if len(page.Users) > limit {
+		page.Users = page.Users[:limit]
+		page.NextCursor = encodeKeyCursor(strconv.Itoa(page.Users[limit-1].ID))
+	}
+
+	users := make([]*models.UserSummary, len(page.Users))
+	for i := range page.Users {
+		users[i] = &page.Users[i].UserSummary
+	}
+	if err := redactUserSummaries(viewerID, users); err != nil {
+		return page, err
+	}
+	return page, nil
+}
+
+// validUserIDKey checks that a cursor holds a user ID
+func validUserIDKey(key string) bool {
+	id, err := strconv.Atoi(key)
+	return err == nil && id > 0
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, to be used with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
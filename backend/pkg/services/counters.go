@@ -0,0 +1,62 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"database/sql"
+	"fmt"
+)
+
+// Counters read on every page of posts are stored alongside the data they
+// count and updated in the same transaction as the rows they count. If they
+// ever drift, RebuildCounters recomputes them from scratch.
+
+// adjustCommentCount adds delta to the number of comments of a post
+func adjustCommentCount(tx *sql.Tx, postID, delta int) error {
+	if _, err := tx.Exec(`UPDATE posts SET comment_count = MAX(comment_count + ?, 0) WHERE id = ?`, delta, postID); err != nil {
+		return fmt.Errorf("failed to update comment count: %w", err)
+	}
+	return nil
+}
+
+// adjustReactionCount adds delta to the number of reactions of one type to a target
+func adjustReactionCount(tx *sql.Tx, targetType string, targetID int, reactionType string, delta int) error {
+	_, err := tx.Exec(`INSERT INTO reaction_counts (target_type, target_id, type, count) VALUES (?, ?, ?, ?)
+		ON CONFLICT (target_type, target_id, type) DO UPDATE SET count = count + excluded.count`,
+		targetType, targetID, reactionType, delta)
+	if err != nil {
+		return fmt.Errorf("failed to update reaction count: %w", err)
+	}
+	// Drop counts that reached zero so that only actual reactions are listed
+	if _, err := tx.Exec(`DELETE FROM reaction_counts WHERE target_type = ? AND target_id = ? AND type = ? AND count <= 0`,
+		targetType, targetID, reactionType); err != nil {
+		return fmt.Errorf("failed to update reaction count: %w", err)
+	}
+	return nil
+}
+
+// RebuildCounters recomputes every denormalized counter from the rows it counts
+func RebuildCounters() error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE posts SET comment_count = (
+		SELECT COUNT(*) FROM comments c WHERE c.post_id = posts.id AND c.deleted_at IS NULL)`); err != nil {
+		return fmt.Errorf("failed to rebuild comment counts: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM reaction_counts`); err != nil {
+		return fmt.Errorf("failed to clear reaction counts: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO reaction_counts (target_type, target_id, type, count)
+		SELECT target_type, target_id, type, COUNT(*) FROM reactions GROUP BY target_type, target_id, type`); err != nil {
+		return fmt.Errorf("failed to rebuild reaction counts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
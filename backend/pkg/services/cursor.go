@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sqliteTimeLayout is the layout of timestamps written by SQLite's datetime('now')
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor builds an opaque pagination cursor pointing after the row
+// created at createdAt with the given ID
+func encodeCursor(createdAt time.Time, id int) string {
+	raw := fmt.Sprintf("%s|%d", createdAt.UTC().Format(sqliteTimeLayout), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns the creation time, in SQLite's layout, and the ID held
+// by a cursor built with encodeCursor
+func decodeCursor(cursor string) (string, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return "", 0, ErrInvalidCursor
+	}
+	if _, err := time.Parse(sqliteTimeLayout, parts[0]); err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, ErrInvalidCursor
+	}
+	return parts[0], id, nil
+}
+
+// encodeKeyCursor builds an opaque pagination cursor from the sort key of the
+// last row of a page, for lists not ordered by creation time
+func encodeKeyCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+// decodeKeyCursor returns the sort key held by a cursor built with
+// encodeKeyCursor, checking it with valid
+func decodeKeyCursor(cursor string, valid func(string) bool) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !valid(string(raw)) {
+		return "", ErrInvalidCursor
+	}
+	return string(raw), nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"fmt"
+)
+
+const (
+	DefaultFeedLimit = 20
+	MaxFeedLimit     = 100
+
+	// maxFeedBatches caps how many batches a feed page reads to make up for
+	// the posts hidden by muted keywords
+	maxFeedBatches = 5
+)
+
+// GetFeed returns one page of the home feed of viewerID: their own posts, the
+// posts of the people they follow that they are allowed to see and the posts
+// shared in the groups they belong to, newest first. Posts of muted users and
+// groups and posts mentioning muted keywords are left out, so a page may hold
+// fewer posts than limit, or none, and still have a NextCursor. cursor is
+// empty for the first page and otherwise the NextCursor of the previous page.
+func GetFeed(viewerID int, cursor string, limit int) (models.FeedPage, error) {
+	page := models.FeedPage{Posts: []models.Post{}}
+
+	if limit <= 0 {
+		limit = DefaultFeedLimit
+	} else if limit > MaxFeedLimit {
+		limit = MaxFeedLimit
+	}
+
+	var cursorTime string
+	var cursorID int
+	if cursor != "" {
+		var err error
+		cursorTime, cursorID, err = decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	mutes, err := loadMuteFilter(viewerID)
+	if err != nil {
+		return page, err
+	}
+
+	// Keywords are matched once the posts are read, so keep reading batches
+	// until the page is full or the feed runs out, up to maxFeedBatches. One
+	// extra post tells whether there is a next page. When the batches run out
+	// first, the page ends at the last post read.
+	for batches := 1; ; batches++ {
+		batch, err := queryFeed(viewerID, cursorTime, cursorID, limit+1)
+		if err != nil {
+			return page, err
+		}
+		for _, post := range batch {
+			if !mutes.hidesPost(post) {
+				page.Posts = append(page.Posts, post)
+			}
+		}
+		if len(page.Posts) > limit || len(batch) <= limit {
+			break
+		}
+		last := batch[len(batch)-1]
+		if batches == maxFeedBatches {
+			page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+			break
+		}
+		cursorTime, cursorID = last.CreatedAt.UTC().Format(sqliteTimeLayout), last.ID
+	}
+
+	if len(page.Posts) > limit {
+		page.Posts = page.Posts[:limit]
+		last := page.Posts[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	if err := loadPosts(viewerID, page.Posts, false); err != nil {
+		return page, err
+	}
+
+	return page, nil
+}
+
+// queryFeed reads up to limit posts of the feed of viewerID older than the
+// cursor, leaving out the posts of muted users. Group posts only come from
+// the groups of the viewer, whoever wrote them.
+func queryFeed(viewerID int, cursorTime string, cursorID, limit int) ([]models.Post, error) {
+	visible, visibleArgs := postVisibilityCondition(viewerID)
+	notMuted, mutedArgs := mutedUserCondition(viewerID, "p.user_id")
+	query := `
+	SELECT ` + postColumns + `
+	FROM posts p
+	WHERE ((p.group_id IS NULL AND (p.user_id = ? OR p.user_id IN (SELECT followed_id FROM followers WHERE follower_id = ?)))
+		OR p.group_id IN (SELECT group_id FROM group_memberships WHERE user_id = ? AND left_at IS NULL))
+		AND ` + visible + `
+		AND ` + notMuted + `
+		AND (? = '' OR p.created_at < ? OR (p.created_at = ? AND p.id < ?))
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT ?`
+
+	args := []interface{}{viewerID, viewerID, viewerID}
+	args = append(args, visibleArgs...)
+	args = append(args, mutedArgs...)
+	args = append(args, cursorTime, cursorTime, cursorTime, cursorID, limit)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feed: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feed post: %w", err)
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over feed: %w", err)
+	}
+	return posts, nil
+}
+
+// GetGroupFeed returns one page of the posts shared in a group, newest first.
+// Callers check that viewerID may see the content of the group. cursor is
+// empty for the first page and otherwise the NextCursor of the previous page.
+func GetGroupFeed(viewerID, groupID int, cursor string, limit int) (models.FeedPage, error) {
+	page := models.FeedPage{Posts: []models.Post{}}
+
+	if limit <= 0 {
+		limit = DefaultFeedLimit
+	} else if limit > MaxFeedLimit {
+		limit = MaxFeedLimit
+	}
+
+	var cursorTime string
+	var cursorID int
+	if cursor != "" {
+		var err error
+		cursorTime, cursorID, err = decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+	}
+
+	visible, visibleArgs := postVisibilityCondition(viewerID)
+	query := `
+	SELECT ` + postColumns + `
+	FROM posts p
+	WHERE p.group_id = ? AND ` + visible + `
+		AND (? = '' OR p.created_at < ? OR (p.created_at = ? AND p.id < ?))
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT ?`
+
+	args := []interface{}{groupID}
+	args = append(args, visibleArgs...)
+	args = append(args, cursorTime, cursorTime, cursorTime, cursorID, limit+1)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return page, fmt.Errorf("failed to query group feed: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return page, fmt.Errorf("failed to scan group post: %w", err)
+		}
+		page.Posts = append(page.Posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error iterating over group feed: %w", err)
+	}
+
+	if len(page.Posts) > limit {
+		page.Posts = page.Posts[:limit]
+		last := page.Posts[limit-1]
+		page.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+
+	if err := loadPosts(viewerID, page.Posts, false); err != nil {
+		return page, err
+	}
+	return page, nil
+}
@@ -4,21 +4,136 @@ import (
 	"Social/pkg/db"
 	"Social/pkg/models"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
-func CreateFollowRequest(request models.FollowRequest) error {
-	request.CreatedAt = time.Now()
+var (
+	ErrFollowSelf              = errors.New("you cannot follow yourself")
+	ErrAlreadyFollowing        = errors.New("already following this user")
+	ErrFollowRequestPending    = errors.New("a follow request is already pending")
+	ErrNotFollowing            = errors.New("not following this user")
+	ErrFollowRequestNotFound   = errors.New("follow request not found")
+	ErrFollowRequestNotPending = errors.New("follow request is no longer pending")
+)
+
+// Follow makes followerID follow followedID. Public accounts are followed
+// immediately and the returned request has the accepted status; private
+// accounts receive a pending follow request instead.
+func Follow(followerID, followedID int) (models.FollowRequest, error) {
+	request := models.FollowRequest{
+		SenderID:    followerID,
+		RecipientID: followedID,
+		CreatedAt:   time.Now(),
+	}
 
-	_, err := db.DB.Exec(`INSERT INTO follow_requests (sender_id, recipient_id, status, created_at)
-		VALUES (?, ?, ?, ?)`, request.SenderID, request.RecipientID, request.Status, request.CreatedAt)
+	if followerID == followedID {
+		return request, ErrFollowSelf
+	}
+
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to create follow request: %w", err)
+		return request, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var isPrivate bool
+	err = tx.QueryRow(`SELECT is_private FROM users WHERE id = ?`, followedID).Scan(&isPrivate)
+	if err == sql.ErrNoRows {
+		return request, ErrUserNotFound
+	} else if err != nil {
+		return request, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	blocked, err := isBlocked(tx, followerID, followedID)
+	if err != nil {
+		return request, err
+	}
+	if blocked {
+		return request, ErrUserBlocked
+	}
+
+	following, err := isFollowing(tx, followerID, followedID)
+	if err != nil {
+		return request, err
+	}
+	if following {
+		return request, ErrAlreadyFollowing
+	}
+
+	var pending bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM follow_requests WHERE sender_id = ? AND recipient_id = ? AND status = ?)`,
+		followerID, followedID, models.FollowRequestPending).Scan(&pending)
+	if err != nil {
+		return request, fmt.Errorf("failed to check pending follow request: %w", err)
+	}
+	if pending {
+		return request, ErrFollowRequestPending
+	}
+
+	if isPrivate {
+		request.Status = models.FollowRequestPending
+		res, err := tx.Exec(`INSERT INTO follow_requests (sender_id, recipient_id, status, created_at)
+			VALUES (?, ?, ?, ?)`, request.SenderID, request.RecipientID, request.Status, request.CreatedAt)
+		if err != nil {
+			return request, fmt.Errorf("failed to create follow request: %w", err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return request, fmt.Errorf("failed to retrieve follow request ID: %w", err)
+		}
+		request.ID = int(id)
+	} else {
+		request.Status = models.FollowRequestAccepted
+		if err := addFollower(tx, followerID, followedID); err != nil {
+			return request, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return request, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, nil
+}
+
+// Unfollow stops followerID from following followedID and takes them out of
+// the audience lists of followedID
+func Unfollow(followerID, followedID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM followers WHERE follower_id = ? AND followed_id = ?`, followerID, followedID)
+	if err != nil {
+		return fmt.Errorf("failed to unfollow: %w", err)
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if affectedRows == 0 {
+		return ErrNotFollowing
+	}
+
+	if err := removeFromAudienceLists(tx, followedID, followerID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 	return nil
 }
 
+// RemoveFollower makes followerID stop following userID
+func RemoveFollower(userID, followerID int) error {
+	return Unfollow(followerID, userID)
+}
+
 func GetFollowRequest(id int) (models.FollowRequest, error) {
 	row := db.DB.QueryRow(`SELECT id, sender_id, recipient_id, status, created_at
 		FROM follow_requests WHERE id = ?`, id)
@@ -26,33 +141,155 @@ func GetFollowRequest(id int) (models.FollowRequest, error) {
 	var request models.FollowRequest
 	if err := row.Scan(&request.ID, &request.SenderID, &request.RecipientID, &request.Status, &request.CreatedAt); err != nil {
 		if err == sql.ErrNoRows {
-			return request, fmt.Errorf("follow request not found")
+			return request, ErrFollowRequestNotFound
 		}
 		return request, fmt.Errorf("failed to get follow request: %w", err)
 	}
 	return request, nil
 }
 
-func UpdateFollowRequest(id int, status string) error {
-	_, err := db.DB.Exec(`UPDATE follow_requests SET status = ? WHERE id = ?`, status, id)
+// ListIncomingFollowRequests returns the pending requests sent to userID
+func ListIncomingFollowRequests(userID int) ([]models.FollowRequest, error) {
+	return listFollowRequests(`SELECT id, sender_id, recipient_id, status, created_at
+		FROM follow_requests WHERE recipient_id = ? AND status = ? ORDER BY created_at DESC`, userID)
+}
+
+// ListOutgoingFollowRequests returns the pending requests sent by userID
+func ListOutgoingFollowRequests(userID int) ([]models.FollowRequest, error) {
+	return listFollowRequests(`SELECT id, sender_id, recipient_id, status, created_at
+		FROM follow_requests WHERE sender_id = ? AND status = ? ORDER BY created_at DESC`, userID)
+}
+
+func listFollowRequests(query string, userID int) ([]models.FollowRequest, error) {
+	rows, err := db.DB.Query(query, userID, models.FollowRequestPending)
 	if err != nil {
-		return fmt.Errorf("failed to update follow request: %w", err)
+		return nil, fmt.Errorf("failed to list follow requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []models.FollowRequest
+	for rows.Next() {
+		var request models.FollowRequest
+		if err := rows.Scan(&request.ID, &request.SenderID, &request.RecipientID, &request.Status, &request.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan follow request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// AcceptFollowRequest accepts a pending request and adds the follower in one transaction
+func AcceptFollowRequest(id int) (models.FollowRequest, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.FollowRequest{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	request, err := resolveFollowRequest(tx, id, models.FollowRequestAccepted)
+	if err != nil {
+		return request, err
+	}
+	if err := addFollower(tx, request.SenderID, request.RecipientID); err != nil {
+		return request, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return request, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, nil
+}
+
+// RejectFollowRequest rejects a pending request
+func RejectFollowRequest(id int) (models.FollowRequest, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.FollowRequest{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	request, err := resolveFollowRequest(tx, id, models.FollowRequestRejected)
+	if err != nil {
+		return request, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return request, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, nil
+}
+
+// CancelFollowRequest withdraws a request that is still pending
+func CancelFollowRequest(id int) error {
+	res, err := db.DB.Exec(`DELETE FROM follow_requests WHERE id = ? AND status = ?`, id, models.FollowRequestPending)
+	if err != nil {
+		return fmt.Errorf("failed to cancel follow request: %w", err)
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if affectedRows == 0 {
+		return ErrFollowRequestNotPending
 	}
 	return nil
 }
 
-func DeleteFollowRequest(id int) error {
-	_, err := db.DB.Exec(`DELETE FROM follow_requests WHERE id = ?`, id)
+// resolveFollowRequest moves a pending request to its final status
+func resolveFollowRequest(tx *sql.Tx, id int, status string) (models.FollowRequest, error) {
+	var request models.FollowRequest
+	err := tx.QueryRow(`SELECT id, sender_id, recipient_id, status, created_at
+		FROM follow_requests WHERE id = ?`, id).Scan(&request.ID, &request.SenderID, &request.RecipientID, &request.Status, &request.CreatedAt)
+	if err == sql.ErrNoRows {
+		return request, ErrFollowRequestNotFound
+	} else if err != nil {
+		return request, fmt.Errorf("failed to get follow request: %w", err)
+	}
+
+	if request.Status != models.FollowRequestPending {
+		return request, ErrFollowRequestNotPending
+	}
+
+	if _, err := tx.Exec(`UPDATE follow_requests SET status = ? WHERE id = ?`, status, id); err != nil {
+		return request, fmt.Errorf("failed to update follow request: %w", err)
+	}
+	request.Status = status
+	return request, nil
+}
+
+// acceptPendingFollowRequests accepts every pending request sent to userID,
+// used when the account switches from private to public
+func acceptPendingFollowRequests(tx *sql.Tx, userID int) error {
+	_, err := tx.Exec(`INSERT OR IGNORE INTO followers (follower_id, followed_id)
+		SELECT sender_id, recipient_id FROM follow_requests WHERE recipient_id = ? AND status = ?`,
+		userID, models.FollowRequestPending)
+	if err != nil {
+		return fmt.Errorf("failed to add followers: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE follow_requests SET status = ? WHERE recipient_id = ? AND status = ?`,
+		models.FollowRequestAccepted, userID, models.FollowRequestPending)
 	if err != nil {
-		return fmt.Errorf("failed to delete follow request: %w", err)
+		return fmt.Errorf("failed to accept follow requests: %w", err)
 	}
 	return nil
 }
 
-func AddFollower(followerID int, followedID int) error {
-	_, err := db.DB.Exec("INSERT INTO followers (follower_id, followed_id) VALUES (?, ?)", followerID, followedID)
+func addFollower(tx *sql.Tx, followerID int, followedID int) error {
+	_, err := tx.Exec("INSERT OR IGNORE INTO followers (follower_id, followed_id) VALUES (?, ?)", followerID, followedID)
 	if err != nil {
 		return fmt.Errorf("failed to add follower: %w", err)
 	}
 	return nil
 }
+
+func isFollowing(tx *sql.Tx, followerID, followedID int) (bool, error) {
+	var following bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ?)`,
+		followerID, followedID).Scan(&following)
+	if err != nil {
+		return false, fmt.Errorf("failed to check follow status: %w", err)
+	}
+	return following, nil
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultGroupLimit = 20
+	MaxGroupLimit     = 100
+)
+
+// Orders of the group directory, largest or most recently active groups first
+const (
+	GroupSortMembers  = "members"
+	GroupSortActivity = "activity"
+)
+
+var ErrInvalidGroupSort = errors.New("sort must be members or activity")
+
+// groupActivityColumn is when a group was last active: the latest of its
+// creation, its newest member, post, event and chat message. Timestamps are
+// normalized with datetime() as they are not all written in the same layout.
+const groupActivityColumn = `MAX(datetime(g.created_at),
+	COALESCE((SELECT MAX(datetime(joined_at)) FROM group_memberships WHERE group_id = g.id), ''),
+	COALESCE((SELECT MAX(datetime(created_at)) FROM posts WHERE group_id = g.id), ''),
+	COALESCE((SELECT MAX(datetime(created_at)) FROM group_events WHERE group_id = g.id), ''),
+	COALESCE((SELECT MAX(datetime(created_at)) FROM chats WHERE group_id = g.id AND is_group), ''))`
+
+// ListGroups returns a page of the group directory sorted by sortBy, members
+// by default. Secret groups are only listed to their members and invitees.
+// search keeps the groups whose title or description match it, every word
+// being matched as a prefix. Each group comes with its member count and how
+// viewerID relates to it. cursor is empty for the first page and otherwise
+// the NextCursor of the previous page.
+func ListGroups(viewerID int, search, sortBy, cursor string, limit int) (models.GroupPage, error) {
+	page := models.GroupPage{Groups: []models.GroupListing{}}
+
+	if limit <= 0 {
+		limit = DefaultGroupLimit
+	} else if limit > MaxGroupLimit {
+		limit = MaxGroupLimit
+	}
+
+	var sortColumn string
+	var validKey func(string) bool
+	switch sortBy {
+	case "", GroupSortMembers:
+		sortBy = GroupSortMembers
+		sortColumn = "d.member_count"
+		validKey = func(key string) bool { _, err := strconv.Atoi(key); return err == nil }
+	case GroupSortActivity:
+		sortColumn = "d.last_active_at"
+		validKey = func(key string) bool { _, err := time.Parse(sqliteTimeLayout, key); return err == nil }
+	default:
+		return page, ErrInvalidGroupSort
+	}
+
+	visible, args := groupVisibilityCondition(viewerID)
+	query := `WITH directory AS (
+		SELECT g.id, g.creator_id, g.title, COALESCE(g.description, '') AS description, g.visibility,
+			g.created_at, g.updated_at,
+			(SELECT COUNT(*) FROM group_memberships WHERE group_id = g.id AND left_at IS NULL) AS member_count,
+			` + groupActivityColumn + ` AS last_active_at
+		FROM groups g
+		WHERE ` + visible
+	if search = strings.TrimSpace(search); search != "" {
+		match := buildMatchQuery(search)
+		if match == "" {
+			return page, ErrEmptySearchQuery
+		}
+		query += ` AND g.id IN (SELECT rowid FROM groups_fts WHERE groups_fts MATCH ?)`
+		args = append(args, match)
+	}
+	query += `)
+	SELECT d.id, d.creator_id, d.title, d.description, d.visibility, d.created_at, d.updated_at, d.member_count, d.last_active_at,
+		COALESCE(gm.role, ''),
+		EXISTS (SELECT 1 FROM group_invitations WHERE group_id = d.id AND invitee_id = ? AND status = ?),
+		EXISTS (SELECT 1 FROM group_requests WHERE group_id = d.id AND requester_id = ? AND status = ?)
+	FROM directory d
+	LEFT JOIN group_memberships gm ON gm.group_id = d.id AND gm.user_id = ? AND gm.left_at IS NULL`
+	args = append(args, viewerID, models.GroupStatusPending, viewerID, models.GroupStatusPending, viewerID)
+
+	if cursor != "" {
+		key, err := decodeKeyCursor(cursor, func(key string) bool {
+			value, id, ok := strings.Cut(key, "|")
+			_, err := strconv.Atoi(id)
+			return ok && err == nil && validKey(value)
+		})
+		if err != nil {
+			return page, err
+		}
+		value, id, _ := strings.Cut(key, "|")
+		afterID, _ := strconv.Atoi(id)
+		var after interface{} = value
+		if sortBy == GroupSortMembers {
+			after, _ = strconv.Atoi(value)
+		}
+		query += ` WHERE (` + sortColumn + ` < ? OR (` + sortColumn + ` = ? AND d.id < ?))`
+		args = append(args, after, after, afterID)
+	}
+	query += ` ORDER BY ` + sortColumn + ` DESC, d.id DESC LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return page, fmt.Errorf("failed to list groups: %w", err)
+	}
+	defer rows.Close()
+
+	var lastActive []string
+	for rows.Next() {
+		var listing models.GroupListing
+		var activity string
+		var invited, requested bool
+		if err := rows.Scan(&listing.ID, &listing.CreatorID, &listing.Title, &listing.Description, &listing.Visibility,
+			&listing.CreatedAt, &listing.UpdatedAt, &listing.MemberCount, &activity,
+			&listing.ViewerRole, &invited, &requested); err != nil {
+			return page, fmt.Errorf("failed to scan group: %w", err)
+		}
+		if listing.LastActiveAt, err = time.Parse(sqliteTimeLayout, activity); err != nil {
+			return page, fmt.Errorf("failed to parse group activity: %w", err)
+		}
+
+		switch {
+		case listing.ViewerRole != "":
+			listing.ViewerStatus = models.GroupViewerMember
+		case invited:
+			listing.ViewerStatus = models.GroupViewerInvited
+		case requested:
+			listing.ViewerStatus = models.GroupViewerRequested
+		default:
+			listing.ViewerStatus = models.GroupViewerNone
+		}
+		page.Groups = append(page.Groups, listing)
+		lastActive = append(lastActive, activity)
+	}
+	if err := rows.Err(); err != nil {
+		return page, fmt.Errorf("error iterating over groups: %w", err)
+	}
+
+	if len(page.Groups) > limit {
+		page.Groups = page.Groups[:limit]
+		last := page.Groups[limit-1]
+		key := strconv.Itoa(last.MemberCount)
+		if sortBy == GroupSortActivity {
+			key = lastActive[limit-1]
+		}
+		page.NextCursor = encodeKeyCursor(key + "|" + strconv.Itoa(last.ID))
+	}
+	return page, nil
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotGroupMember      = errors.New("user is not currently a member of the group")
+	ErrInvalidGroupRole    = errors.New("invalid group role")
+	ErrOwnerMustTransfer   = errors.New("the owner must transfer ownership before leaving the group")
+	ErrCannotChangeOwnRole = errors.New("you cannot change your own role")
+)
+
+// GroupPermission is something only some members of a group may do
+type GroupPermission string
+
+const (
+	PermInviteMembers   GroupPermission = "invite_members"
+	PermCreateEvents    GroupPermission = "create_events"
+	PermRemovePosts     GroupPermission = "remove_posts"
+	PermApproveRequests GroupPermission = "approve_requests"
+	PermRemoveMembers   GroupPermission = "remove_members"
+	PermManageRoles     GroupPermission = "manage_roles"
+	PermEditGroup       GroupPermission = "edit_group"
+	PermDeleteGroup     GroupPermission = "delete_group"
+	PermTransferGroup   GroupPermission = "transfer_group"
+)
+
+// groupRoleRanks orders the roles; members can only act on lower ranked members
+var groupRoleRanks = map[string]int{
+	models.GroupRoleMember:    1,
+	models.GroupRoleModerator: 2,
+	models.GroupRoleAdmin:     3,
+	models.GroupRoleOwner:     4,
+}
+
+// groupRolePermissions lists what each role is allowed to do
+var groupRolePermissions = map[string][]GroupPermission{
+	models.GroupRoleMember:    {PermInviteMembers, PermCreateEvents},
+	models.GroupRoleModerator: {PermInviteMembers, PermCreateEvents, PermApproveRequests, PermRemoveMembers, PermRemovePosts},
+	models.GroupRoleAdmin: {PermInviteMembers, PermCreateEvents, PermApproveRequests, PermRemoveMembers, PermRemovePosts,
+		PermManageRoles},
+	models.GroupRoleOwner: {PermInviteMembers, PermCreateEvents, PermApproveRequests, PermRemoveMembers, PermRemovePosts,
+		PermManageRoles, PermEditGroup, PermDeleteGroup, PermTransferGroup},
+}
+
+// GetGroupRole returns the role of a current member of the group, or an
+// empty string when the user does not belong to it
+func GetGroupRole(groupID, userID int) (string, error) {
+	var role string
+	err := db.DB.QueryRow(`SELECT role FROM group_memberships
+		WHERE group_id = ? AND user_id = ? AND left_at IS NULL`, groupID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to get group role: %w", err)
+	}
+	return role, nil
+}
+
+// RoleHasPermission reports whether members with the given role hold the permission
+func RoleHasPermission(role string, permission GroupPermission) bool {
+	for _, p := range groupRolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// HasGroupPermission reports whether the user's role in the group grants the permission
+func HasGroupPermission(groupID, userID int, permission GroupPermission) (bool, error) {
+	role, err := GetGroupRole(groupID, userID)
+	if err != nil {
+		return false, err
+	}
+	return RoleHasPermission(role, permission), nil
+}
+
+// ListGroupMembers returns the current members of a group, highest roles first
+func ListGroupMembers(groupID int) ([]models.GroupMembership, error) {
+	rows, err := db.DB.Query(`SELECT user_id, group_id, role, joined_at FROM group_memberships
+		WHERE group_id = ? AND left_at IS NULL
+		ORDER BY CASE role WHEN ? THEN 0 WHEN ? THEN 1 WHEN ? THEN 2 ELSE 3 END, joined_at`,
+		groupID, models.GroupRoleOwner, models.GroupRoleAdmin, models.GroupRoleModerator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.GroupMembership
+	for rows.Next() {
+		var member models.GroupMembership
+		if err := rows.Scan(&member.UserID, &member.GroupID, &member.Role, &member.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		members = append(members, member)
+	}
+	return members, rows.Err()
+}
+
+// GetGroupMemberIDsWithPermission returns the current members whose role grants the permission
+func GetGroupMemberIDsWithPermission(groupID int, permission GroupPermission) ([]int, error) {
+	var memberIDs []int
+	members, err := ListGroupMembers(groupID)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range members {
+		if RoleHasPermission(member.Role, permission) {
+			memberIDs = append(memberIDs, member.UserID)
+		}
+	}
+	return memberIDs, nil
+}
+
+// SetMemberRole promotes or demotes a member. The acting member must outrank
+// both the member's current role and the new one, so admins can manage
+// moderators and members while only the owner can appoint admins. Ownership
+// changes go through TransferGroupOwnership.
+func SetMemberRole(actorID, groupID, userID int, role string) error {
+	if role == models.GroupRoleOwner || groupRoleRanks[role] == 0 {
+		return ErrInvalidGroupRole
+	}
+	if actorID == userID {
+		return ErrCannotChangeOwnRole
+	}
+
+	actorRole, err := GetGroupRole(groupID, actorID)
+	if err != nil {
+		return err
+	}
+	currentRole, err := GetGroupRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if currentRole == "" {
+		return ErrNotGroupMember
+	}
+
+	if !RoleHasPermission(actorRole, PermManageRoles) ||
+		groupRoleRanks[actorRole] <= groupRoleRanks[currentRole] ||
+		groupRoleRanks[actorRole] <= groupRoleRanks[role] {
+		return ErrForbidden
+	}
+
+	_, err = db.DB.Exec(`UPDATE group_memberships SET role = ?
+		WHERE group_id = ? AND user_id = ? AND left_at IS NULL`, role, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update group role: %w", err)
+	}
+	return nil
+}
+
+// RemoveGroupMember removes a lower ranked member from the group
+func RemoveGroupMember(actorID, groupID, userID int) error {
+	actorRole, err := GetGroupRole(groupID, actorID)
+	if err != nil {
+		return err
+	}
+	role, err := GetGroupRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrNotGroupMember
+	}
+
+	if !RoleHasPermission(actorRole, PermRemoveMembers) || groupRoleRanks[actorRole] <= groupRoleRanks[role] {
+		return ErrForbidden
+	}
+
+	_, err = db.DB.Exec(`UPDATE group_memberships SET left_at = ?
+		WHERE group_id = ? AND user_id = ? AND left_at IS NULL`, time.Now(), groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+	return nil
+}
+
+// TransferGroupOwnership hands the group over to another current member.
+// The previous owner stays in the group as an admin.
+func TransferGroupOwnership(ownerID, groupID, newOwnerID int) error {
+	if ownerID == newOwnerID {
+		return ErrCannotChangeOwnRole
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var newOwnerRole string
+	err = tx.QueryRow(`SELECT role FROM group_memberships
+		WHERE group_id = ? AND user_id = ? AND left_at IS NULL`, groupID, newOwnerID).Scan(&newOwnerRole)
+	if err == sql.ErrNoRows {
+		return ErrNotGroupMember
+	} else if err != nil {
+		return fmt.Errorf("failed to get group role: %w", err)
+	}
+
+	res, err := tx.Exec(`UPDATE group_memberships SET role = ?
+		WHERE group_id = ? AND user_id = ? AND role = ? AND left_at IS NULL`,
+		models.GroupRoleAdmin, groupID, ownerID, models.GroupRoleOwner)
+	if err != nil {
+		return fmt.Errorf("failed to update previous owner: %w", err)
+	}
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	} else if affectedRows == 0 {
+		return ErrForbidden
+	}
+
+	if _, err := tx.Exec(`UPDATE group_memberships SET role = ? WHERE group_id = ? AND user_id = ?`,
+		models.GroupRoleOwner, groupID, newOwnerID); err != nil {
+		return fmt.Errorf("failed to update new owner: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE groups SET creator_id = ?, updated_at = ? WHERE id = ?`,
+		newOwnerID, time.Now(), groupID); err != nil {
+		return fmt.Errorf("failed to update group owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// addGroupMember adds a user to a group with the given role, bringing back
+// the membership of a user who left the group before
+func addGroupMember(tx *sql.Tx, groupID, userID int, role string) error {
+	_, err := tx.Exec(`INSERT INTO group_memberships (group_id, user_id, joined_at, role)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (user_id, group_id) DO UPDATE SET joined_at = excluded.joined_at, role = excluded.role, left_at = NULL`,
+		groupID, userID, time.Now(), role)
+	if err != nil {
+		return fmt.Errorf("failed to add group member: %w", err)
+	}
+	return nil
+}
@@ -4,17 +4,79 @@ import (
 	"Social/pkg/db"
 	"Social/pkg/models"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
+var (
+	ErrInviteSelf             = errors.New("you cannot invite yourself")
+	ErrAlreadyGroupMember     = errors.New("user is already a member of the group")
+	ErrGroupInvitationPending = errors.New("an invitation to this group is already pending")
+	ErrGroupRequestPending    = errors.New("a request to join this group is already pending")
+	ErrGroupEntryNotPending   = errors.New("this invitation or request is no longer pending")
+	ErrInvalidGroupStatus     = errors.New("status must be accepted or rejected")
+	ErrEmptyGroupTitle        = errors.New("group title cannot be empty")
+	ErrInvalidGroupVisibility = errors.New("visibility must be public, private or secret")
+	ErrGroupRequiresRequest   = errors.New("this group is private, send a request to join it")
+	ErrGroupInviteOnly        = errors.New("this group can only be joined by invitation")
+)
+
+// validGroupVisibility reports whether visibility is one of the supported group visibilities
+func validGroupVisibility(visibility string) bool {
+	switch visibility {
+	case models.GroupVisibilityPublic, models.GroupVisibilityPrivate, models.GroupVisibilitySecret:
+		return true
+	}
+	return false
+}
+
+// groupVisibilityCondition returns an SQL condition over groups aliased as g
+// that only holds for the groups viewerID may know of, with its arguments.
+// Secret groups are only known to their members and the users invited to them.
+func groupVisibilityCondition(viewerID int) (string, []interface{}) {
+	condition := `(g.visibility != ?
+		OR EXISTS (SELECT 1 FROM group_memberships WHERE group_id = g.id AND user_id = ? AND left_at IS NULL)
+		OR EXISTS (SELECT 1 FROM group_invitations WHERE group_id = g.id AND invitee_id = ? AND status = ?))`
+	return condition, []interface{}{models.GroupVisibilitySecret, viewerID, viewerID, models.GroupStatusPending}
+}
+
+// groupContentCondition returns an SQL condition over groups aliased as g
+// that only holds for the groups whose content, such as their members and
+// events, viewerID may see, with its arguments. The content of public groups
+// is open to everyone, that of other groups to their members only.
+func groupContentCondition(viewerID int) (string, []interface{}) {
+	condition := `(g.visibility = ?
+		OR EXISTS (SELECT 1 FROM group_memberships WHERE group_id = g.id AND user_id = ? AND left_at IS NULL))`
+	return condition, []interface{}{models.GroupVisibilityPublic, viewerID}
+}
+
+// CreateGroup creates a group and makes its creator the owner
 func CreateGroup(group models.Group) (int, error) {
+	group.Description = stripControlChars(group.Description)
+	if group.Title = strings.TrimSpace(stripControlChars(group.Title)); group.Title == "" {
+		return 0, ErrEmptyGroupTitle
+	}
+	if group.Visibility == "" {
+		group.Visibility = models.GroupVisibilityPublic
+	}
+	if !validGroupVisibility(group.Visibility) {
+		return 0, ErrInvalidGroupVisibility
+	}
+
 	now := time.Now()
 	group.CreatedAt = now
 	group.UpdatedAt = now
 
-	res, err := db.DB.Exec(`INSERT INTO groups (creator_id, title, description, created_at, updated_at) 
-                            VALUES (?, ?, ?, ?, ?)`, group.CreatorID, group.Title, group.Description, group.CreatedAt, group.UpdatedAt)
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO groups (creator_id, title, description, visibility, created_at, updated_at) 
+                         VALUES (?, ?, ?, ?, ?, ?)`, group.CreatorID, group.Title, group.Description, group.Visibility, group.CreatedAt, group.UpdatedAt)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create group: %w", err)
 	}
@@ -24,84 +86,405 @@ func CreateGroup(group models.Group) (int, error) {
 		return 0, fmt.Errorf("failed to retrieve group ID: %w", err)
 	}
 
+	if err := addGroupMember(tx, int(groupID), group.CreatorID, models.GroupRoleOwner); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return int(groupID), nil
 }
 
+// GetGroup returns a group. Callers check that the viewer may know of it.
 func GetGroup(groupID int) (models.Group, error) {
 	var group models.Group
-	row := db.DB.QueryRow(`SELECT id, creator_id, title, description, created_at, updated_at 
+	row := db.DB.QueryRow(`SELECT id, creator_id, title, COALESCE(description, ''), visibility, created_at, updated_at 
                            FROM groups WHERE id = ?`, groupID)
-	err := row.Scan(&group.ID, &group.CreatorID, &group.Title, &group.Description, &group.CreatedAt, &group.UpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return group, fmt.Errorf("group not found")
-		}
+	err := row.Scan(&group.ID, &group.CreatorID, &group.Title, &group.Description, &group.Visibility, &group.CreatedAt, &group.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return group, ErrNotFound
+	} else if err != nil {
 		return group, fmt.Errorf("failed to get group: %w", err)
 	}
 	return group, nil
 }
 
-func ListGroups(offset, limit int, searchTerm string) ([]models.Group, error) {
-	rows, err := db.DB.Query(`SELECT id, creator_id, title, description, created_at, updated_at 
-                              FROM groups WHERE title LIKE ? LIMIT ? OFFSET ?`, "%"+searchTerm+"%", limit, offset)
+// UpdateGroup changes the title, description and visibility of a group and
+// returns it updated. An empty visibility keeps the current one.
+func UpdateGroup(groupID int, group models.Group) (models.Group, error) {
+	var updated models.Group
+	group.Description = stripControlChars(group.Description)
+	if group.Title = strings.TrimSpace(stripControlChars(group.Title)); group.Title == "" {
+		return updated, ErrEmptyGroupTitle
+	}
+	if group.Visibility != "" && !validGroupVisibility(group.Visibility) {
+		return updated, ErrInvalidGroupVisibility
+	}
+
+	err := db.DB.QueryRow(`UPDATE groups SET title = ?, description = ?, visibility = COALESCE(NULLIF(?, ''), visibility), updated_at = ?
+		WHERE id = ?
+		RETURNING id, creator_id, title, COALESCE(description, ''), visibility, created_at, updated_at`,
+		group.Title, group.Description, group.Visibility, time.Now(), groupID).Scan(&updated.ID, &updated.CreatorID,
+		&updated.Title, &updated.Description, &updated.Visibility, &updated.CreatedAt, &updated.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return updated, ErrNotFound
+	} else if err != nil {
+		return updated, fmt.Errorf("failed to update group: %w", err)
+	}
+	return updated, nil
+}
+
+// DeleteGroup deletes a group along with everything that only exists within
+// it: its memberships, invitations and join requests, its posts with their
+// comments and reactions, its events and their RSVPs, its chat messages and
+// their reactions, and the mutes of the group
+func DeleteGroup(groupID int) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		query string
+		args  []interface{}
+		what  string
+	}{
+		{`DELETE FROM event_rsvps WHERE event_id IN (SELECT id FROM group_events WHERE group_id = ?)`,
+			[]interface{}{groupID}, "event responses"},
+		{`DELETE FROM group_events WHERE group_id = ?`, []interface{}{groupID}, "events"},
+		{`DELETE FROM reactions WHERE target_type = ? AND target_id IN (
+			SELECT c.id FROM comments c JOIN posts p ON p.id = c.post_id WHERE p.group_id = ?)`,
+			[]interface{}{models.ReactionTargetComment, groupID}, "comment reactions"},
+		{`DELETE FROM reaction_counts WHERE target_type = ? AND target_id IN (
+			SELECT c.id FROM comments c JOIN posts p ON p.id = c.post_id WHERE p.group_id = ?)`,
+			[]interface{}{models.ReactionTargetComment, groupID}, "comment reaction counts"},
+		{`DELETE FROM comments WHERE post_id IN (SELECT id FROM posts WHERE group_id = ?)`, []interface{}{groupID}, "comments"},
+		{`DELETE FROM reactions WHERE target_type = ? AND target_id IN (SELECT id FROM posts WHERE group_id = ?)`,
+			[]interface{}{models.ReactionTargetPost, groupID}, "post reactions"},
+		{`DELETE FROM reaction_counts WHERE target_type = ? AND target_id IN (SELECT id FROM posts WHERE group_id = ?)`,
+			[]interface{}{models.ReactionTargetPost, groupID}, "post reaction counts"},
+		{`DELETE FROM posts WHERE group_id = ?`, []interface{}{groupID}, "posts"},
+		{`DELETE FROM reactions WHERE target_type = ? AND target_id IN (SELECT id FROM chats WHERE group_id = ? AND is_group)`,
+			[]interface{}{models.ReactionTargetMessage, groupID}, "message reactions"},
+		{`DELETE FROM reaction_counts WHERE target_type = ? AND target_id IN (SELECT id FROM chats WHERE group_id = ? AND is_group)`,
+			[]interface{}{models.ReactionTargetMessage, groupID}, "message reaction counts"},
+		{`DELETE FROM chats WHERE group_id = ? AND is_group`, []interface{}{groupID}, "chat messages"},
+		{`DELETE FROM group_invitations WHERE group_id = ?`, []interface{}{groupID}, "invitations"},
+		{`DELETE FROM group_requests WHERE group_id = ?`, []interface{}{groupID}, "join requests"},
+		{`DELETE FROM group_memberships WHERE group_id = ?`, []interface{}{groupID}, "memberships"},
+		{`DELETE FROM mutes WHERE target_type = ? AND target_id = ?`, []interface{}{models.MuteTargetGroup, groupID}, "mutes"},
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement.query, statement.args...); err != nil {
+			return fmt.Errorf("failed to delete group %s: %w", statement.what, err)
+		}
+	}
+
+	res, err := tx.Exec(`DELETE FROM groups WHERE id = ?`, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if affectedRows, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	} else if affectedRows == 0 {
+		return ErrNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// InviteToGroup invites a user who is not yet a member of the group and
+// returns the ID of the invitation
+func InviteToGroup(invitation models.GroupInvitation) (int, error) {
+	if invitation.InviterID == invitation.InviteeID {
+		return 0, ErrInviteSelf
+	}
+
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list groups: %w", err)
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userExists bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, invitation.InviteeID).Scan(&userExists)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up user: %w", err)
+	}
+	if !userExists {
+		return 0, ErrUserNotFound
+	}
+
+	blocked, err := isBlocked(tx, invitation.InviterID, invitation.InviteeID)
+	if err != nil {
+		return 0, err
+	}
+	if blocked {
+		return 0, ErrUserBlocked
+	}
+
+	if err := checkNotGroupMember(tx, invitation.GroupID, invitation.InviteeID); err != nil {
+		return 0, err
+	}
+
+	var pending bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_invitations WHERE group_id = ? AND invitee_id = ? AND status = ?)`,
+		invitation.GroupID, invitation.InviteeID, models.GroupStatusPending).Scan(&pending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check pending invitation: %w", err)
+	}
+	if pending {
+		return 0, ErrGroupInvitationPending
+	}
+
+	invitation.Status = models.GroupStatusPending
+	invitation.InvitedAt = time.Now()
+	res, err := tx.Exec(`INSERT INTO group_invitations (group_id, inviter_id, invitee_id, status, invited_at) 
+                         VALUES (?, ?, ?, ?, ?)`, invitation.GroupID, invitation.InviterID, invitation.InviteeID, invitation.Status, invitation.InvitedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to invite user to group: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve invitation ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(id), nil
+}
+
+// ListGroupInvitations returns the pending invitations sent to userID
+func ListGroupInvitations(userID int) ([]models.GroupInvitation, error) {
+	rows, err := db.DB.Query(`SELECT id, group_id, inviter_id, invitee_id, status, invited_at, responded_at
+		FROM group_invitations WHERE invitee_id = ? AND status = ? ORDER BY invited_at DESC`, userID, models.GroupStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group invitations: %w", err)
 	}
 	defer rows.Close()
 
-	var groups []models.Group
+	var invitations []models.GroupInvitation
 	for rows.Next() {
-		var group models.Group
-		if err := rows.Scan(&group.ID, &group.CreatorID, &group.Title, &group.Description, &group.CreatedAt, &group.UpdatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan group: %w", err)
+		var invitation models.GroupInvitation
+		if err := rows.Scan(&invitation.ID, &invitation.GroupID, &invitation.InviterID, &invitation.InviteeID,
+			&invitation.Status, &invitation.InvitedAt, &invitation.RespondedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group invitation: %w", err)
 		}
-		groups = append(groups, group)
+		invitations = append(invitations, invitation)
 	}
-	return groups, nil
+	return invitations, rows.Err()
 }
 
-func InviteToGroup(invitation models.GroupInvitation) error {
-	now := time.Now()
-	invitation.InvitedAt = now
+// RespondToInvitation accepts or rejects a pending invitation. Accepting it
+// makes the invitee a member of the group.
+func RespondToInvitation(invitationID int, status string) (models.GroupInvitation, error) {
+	var invitation models.GroupInvitation
+	if status != models.GroupStatusAccepted && status != models.GroupStatusRejected {
+		return invitation, ErrInvalidGroupStatus
+	}
 
-	_, err := db.DB.Exec(`INSERT INTO group_invitations (group_id, inviter_id, invitee_id, status, invited_at) 
-                          VALUES (?, ?, ?, ?, ?)`, invitation.GroupID, invitation.InviterID, invitation.InviteeID, invitation.Status, invitation.InvitedAt)
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to invite user to group: %w", err)
+		return invitation, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT id, group_id, inviter_id, invitee_id, status, invited_at FROM group_invitations WHERE id = ?`,
+		invitationID).Scan(&invitation.ID, &invitation.GroupID, &invitation.InviterID, &invitation.InviteeID,
+		&invitation.Status, &invitation.InvitedAt)
+	if err == sql.ErrNoRows {
+		return invitation, ErrNotFound
+	} else if err != nil {
+		return invitation, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	if invitation.Status != models.GroupStatusPending {
+		return invitation, ErrGroupEntryNotPending
 	}
-	return nil
-}
 
-func RespondToInvitation(invitationID int, status string) error {
 	now := time.Now()
+	invitation.Status = status
+	invitation.RespondedAt = &now
+	_, err = tx.Exec(`UPDATE group_invitations SET status = ?, responded_at = ? 
+                      WHERE id = ?`, status, now, invitationID)
+	if err != nil {
+		return invitation, fmt.Errorf("failed to respond to invitation: %w", err)
+	}
+
+	if status == models.GroupStatusAccepted {
+		if err := admitToGroup(tx, invitation.GroupID, invitation.InviteeID); err != nil {
+			return invitation, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return invitation, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return invitation, nil
+}
 
-	_, err := db.DB.Exec(`UPDATE group_invitations SET status = ?, responded_at = ? 
-                          WHERE id = ?`, status, now, invitationID)
+// CreateGroupRequest asks for the requester to join the group and returns the
+// ID of the request. Secret groups do not take requests.
+func CreateGroupRequest(request models.GroupRequest) (int, error) {
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to respond to invitation: %w", err)
+		return 0, fmt.Errorf("could not start transaction: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	visibility, err := groupVisibility(tx, request.GroupID)
+	if err != nil {
+		return 0, err
+	}
+	if visibility == models.GroupVisibilitySecret {
+		return 0, ErrGroupInviteOnly
+	}
+
+	if err := checkNotGroupMember(tx, request.GroupID, request.RequesterID); err != nil {
+		return 0, err
+	}
+
+	var pending bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_requests WHERE group_id = ? AND requester_id = ? AND status = ?)`,
+		request.GroupID, request.RequesterID, models.GroupStatusPending).Scan(&pending)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check pending group request: %w", err)
+	}
+	if pending {
+		return 0, ErrGroupRequestPending
+	}
+
+	request.Status = models.GroupStatusPending
+	request.RequestedAt = time.Now()
+	res, err := tx.Exec(`INSERT INTO group_requests (group_id, requester_id, status, requested_at) 
+                         VALUES (?, ?, ?, ?)`, request.GroupID, request.RequesterID, request.Status, request.RequestedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create group request: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve group request ID: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return int(id), nil
 }
 
-func CreateGroupRequest(request models.GroupRequest) error {
-	now := time.Now()
-	request.RequestedAt = now
+// ListGroupRequests returns the pending requests to join the group
+func ListGroupRequests(groupID int) ([]models.GroupRequest, error) {
+	rows, err := db.DB.Query(`SELECT id, group_id, requester_id, status, requested_at, responded_at
+		FROM group_requests WHERE group_id = ? AND status = ? ORDER BY requested_at`, groupID, models.GroupStatusPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []models.GroupRequest
+	for rows.Next() {
+		var request models.GroupRequest
+		if err := rows.Scan(&request.ID, &request.GroupID, &request.RequesterID, &request.Status,
+			&request.RequestedAt, &request.RespondedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan group request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// RespondToGroupRequest accepts or rejects a pending request to join a group.
+// Accepting it makes the requester a member of the group.
+func RespondToGroupRequest(requestID int, status string) (models.GroupRequest, error) {
+	var request models.GroupRequest
+	if status != models.GroupStatusAccepted && status != models.GroupStatusRejected {
+		return request, ErrInvalidGroupStatus
+	}
 
-	_, err := db.DB.Exec(`INSERT INTO group_requests (group_id, requester_id, status, requested_at) 
-                          VALUES (?, ?, ?, ?)`, request.GroupID, request.RequesterID, request.Status, request.RequestedAt)
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to create group request: %w", err)
+		return request, fmt.Errorf("could not start transaction: %w", err)
 	}
-	return nil
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT id, group_id, requester_id, status, requested_at FROM group_requests WHERE id = ?`,
+		requestID).Scan(&request.ID, &request.GroupID, &request.RequesterID, &request.Status, &request.RequestedAt)
+	if err == sql.ErrNoRows {
+		return request, ErrNotFound
+	} else if err != nil {
+		return request, fmt.Errorf("failed to get group request: %w", err)
+	}
+	if request.Status != models.GroupStatusPending {
+		return request, ErrGroupEntryNotPending
+	}
+
+	now := time.Now()
+	request.Status = status
+	request.RespondedAt = &now
+	_, err = tx.Exec(`UPDATE group_requests SET status = ?, responded_at = ? 
+                      WHERE id = ?`, status, now, requestID)
+	if err != nil {
+		return request, fmt.Errorf("failed to respond to group request: %w", err)
+	}
+
+	if status == models.GroupStatusAccepted {
+		if err := admitToGroup(tx, request.GroupID, request.RequesterID); err != nil {
+			return request, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return request, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return request, nil
 }
 
-func RespondToGroupRequest(requestID int, status string) error {
+// admitToGroup makes the user a member of the group and settles the other
+// invitations and requests still pending for them, which are now moot
+func admitToGroup(tx *sql.Tx, groupID, userID int) error {
+	if err := addGroupMember(tx, groupID, userID, models.GroupRoleMember); err != nil {
+		return err
+	}
+
 	now := time.Now()
+	if _, err := tx.Exec(`UPDATE group_invitations SET status = ?, responded_at = ?
+		WHERE group_id = ? AND invitee_id = ? AND status = ?`,
+		models.GroupStatusAccepted, now, groupID, userID, models.GroupStatusPending); err != nil {
+		return fmt.Errorf("failed to settle group invitations: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE group_requests SET status = ?, responded_at = ?
+		WHERE group_id = ? AND requester_id = ? AND status = ?`,
+		models.GroupStatusAccepted, now, groupID, userID, models.GroupStatusPending); err != nil {
+		return fmt.Errorf("failed to settle group requests: %w", err)
+	}
+	return nil
+}
+
+// groupVisibility returns the visibility of a group, or ErrNotFound
+func groupVisibility(tx *sql.Tx, groupID int) (string, error) {
+	var visibility string
+	err := tx.QueryRow(`SELECT visibility FROM groups WHERE id = ?`, groupID).Scan(&visibility)
+	if err != nil {
+		return "", notFoundOr(err, "failed to get group visibility")
+	}
+	return visibility, nil
+}
 
-	_, err := db.DB.Exec(`UPDATE group_requests SET status = ?, responded_at = ? 
-                          WHERE id = ?`, status, now, requestID)
+// checkNotGroupMember returns ErrAlreadyGroupMember when the user currently belongs to the group
+func checkNotGroupMember(tx *sql.Tx, groupID, userID int) error {
+	var isMember bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_memberships 
+                        WHERE group_id = ? AND user_id = ? AND left_at IS NULL)`, groupID, userID).Scan(&isMember)
 	if err != nil {
-		return fmt.Errorf("failed to respond to group request: %w", err)
+		return fmt.Errorf("failed to check group membership: %w", err)
+	}
+	if isMember {
+		return ErrAlreadyGroupMember
 	}
 	return nil
 }
@@ -146,49 +529,91 @@ func GetGroupEvent(groupID, eventID int) (models.GroupEvent, error) {
     return event, nil
 }
 
+// JoinGroup makes the user a member of a public group. Private groups are
+// joined through a request and secret ones through an invitation.
 func JoinGroup(groupID, userID int) error {
-    now := time.Now()
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
 
-    // Check if the user is already a member of the group
-    var exists bool
-    err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_memberships WHERE group_id = ? AND user_id = ?)`, groupID, userID).Scan(&exists)
-    if err != nil {
-        return fmt.Errorf("failed to check group membership: %w", err)
-    }
+	if err := checkNotGroupMember(tx, groupID, userID); err != nil {
+		return err
+	}
 
-    if exists {
-        return fmt.Errorf("user is already a member of the group")
-    }
+	visibility, err := groupVisibility(tx, groupID)
+	if err != nil {
+		return err
+	}
+	switch visibility {
+	case models.GroupVisibilityPrivate:
+		return ErrGroupRequiresRequest
+	case models.GroupVisibilitySecret:
+		return ErrGroupInviteOnly
+	}
 
-    // Insert a new membership record
-    _, err = db.DB.Exec(`INSERT INTO group_memberships (group_id, user_id, joined_at) 
-                         VALUES (?, ?, ?)`, groupID, userID, now)
-    if err != nil {
-        return fmt.Errorf("failed to join group: %w", err)
-    }
+	// Members who left before join again as plain members
+	if err := admitToGroup(tx, groupID, userID); err != nil {
+		return err
+	}
 
-    return nil
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
 func LeaveGroup(groupID, userID int) error {
-    now := time.Now()
+	role, err := GetGroupRole(groupID, userID)
+	if err != nil {
+		return err
+	}
+	if role == "" {
+		return ErrNotGroupMember
+	}
+	// A group always keeps an owner
+	if role == models.GroupRoleOwner {
+		return ErrOwnerMustTransfer
+	}
 
-    // Update the membership record to indicate the user left the group
-    res, err := db.DB.Exec(`UPDATE group_memberships SET left_at = ? 
-                            WHERE group_id = ? AND user_id = ? AND left_at IS NULL`, now, groupID, userID)
-    if err != nil {
-        return fmt.Errorf("failed to leave group: %w", err)
-    }
+	// Update the membership record to indicate the user left the group
+	_, err = db.DB.Exec(`UPDATE group_memberships SET left_at = ? 
+                         WHERE group_id = ? AND user_id = ? AND left_at IS NULL`, time.Now(), groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to leave group: %w", err)
+	}
 
-    // Check if any rows were updated
-    affectedRows, err := res.RowsAffected()
-    if err != nil {
-        return fmt.Errorf("failed to check affected rows: %w", err)
-    }
-    if affectedRows == 0 {
-        return fmt.Errorf("user is not currently a member of the group")
-    }
+	return nil
+}
 
-    return nil
+// IsGroupMember reports whether the user currently belongs to the group
+func IsGroupMember(groupID, userID int) (bool, error) {
+	var isMember bool
+	err := db.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM group_memberships 
+                           WHERE group_id = ? AND user_id = ? AND left_at IS NULL)`, groupID, userID).Scan(&isMember)
+	if err != nil {
+		return false, fmt.Errorf("failed to check group membership: %w", err)
+	}
+	return isMember, nil
 }
 
+// GetGroupMemberIDs returns the IDs of the users currently belonging to the group
+func GetGroupMemberIDs(groupID int) ([]int, error) {
+	rows, err := db.DB.Query(`SELECT user_id FROM group_memberships 
+                              WHERE group_id = ? AND left_at IS NULL`, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list group members: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan group member: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	MinHandleLength = 3
+	MaxHandleLength = 30
+
+	// HandleChangeCooldown is how long users wait between two handle changes
+	HandleChangeCooldown = 30 * 24 * time.Hour
+	// HandleRedirectPeriod is how long a former handle keeps pointing to its user
+	HandleRedirectPeriod = 14 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidHandle       = errors.New("handle must be 3 to 30 letters, digits or underscores, and not only digits")
+	ErrReservedHandle      = errors.New("this handle is reserved")
+	ErrHandleTaken         = errors.New("this handle is already taken")
+	ErrHandleChangeTooSoon = errors.New("handle can only be changed once every 30 days")
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// reservedHandles cannot be chosen by anyone, as they name routes, roles or
+// would mislead other users
+var reservedHandles = map[string]bool{
+	"about": true, "admin": true, "administrator": true, "api": true, "auth": true, "chat": true,
+	"chats": true, "comments": true, "feed": true, "follow": true, "followers": true, "following": true,
+	"groups": true, "help": true, "login": true, "logout": true, "me": true, "media": true,
+	"moderator": true, "mutes": true, "notifications": true, "null": true, "official": true,
+	"post": true, "posts": true, "privacy": true, "profile": true, "register": true, "root": true,
+	"search": true, "settings": true, "signup": true, "staff": true, "support": true, "system": true,
+	"terms": true, "u": true, "undefined": true, "uploads": true,
+}
+
+// ValidateHandle checks the format of a handle and that it is not reserved
+func ValidateHandle(handle string) error {
+	if len(handle) < MinHandleLength || len(handle) > MaxHandleLength || !handlePattern.MatchString(handle) ||
+		strings.Trim(handle, "0123456789") == "" {
+		return ErrInvalidHandle
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return ErrReservedHandle
+	}
+	return nil
+}
+
+// checkHandleAvailable returns ErrHandleTaken when another user than userID
+// has the handle, or had it recently enough that it still redirects to them
+func checkHandleAvailable(q queryRower, handle string, userID int) error {
+	var taken bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE handle = ? COLLATE NOCASE AND id != ?)
+		OR EXISTS(SELECT 1 FROM handle_redirects WHERE handle = ? AND user_id != ? AND expires_at > ?)`,
+		handle, userID, handle, userID, time.Now().UTC()).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to check handle: %w", err)
+	}
+	if taken {
+		return ErrHandleTaken
+	}
+	return nil
+}
+
+// SetHandle gives userID a new handle. Users without a handle, such as OAuth
+// users being onboarded, may pick one at any time; changing an existing
+// handle is limited to once per HandleChangeCooldown, and the former handle
+// redirects to the user for HandleRedirectPeriod. Changing only the case of
+// the handle is always allowed.
+func SetHandle(userID int, handle string) error {
+	if err := ValidateHandle(handle); err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current sql.NullString
+	var changedAt sql.NullTime
+	err = tx.QueryRow(`SELECT handle, handle_changed_at FROM users WHERE id = ?`, userID).Scan(&current, &changedAt)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return fmt.Errorf("failed to look up handle: %w", err)
+	}
+
+	now := time.Now().UTC()
+	renamed := current.Valid && !strings.EqualFold(current.String, handle)
+	if renamed && changedAt.Valid && now.Sub(changedAt.Time) < HandleChangeCooldown {
+		return ErrHandleChangeTooSoon
+	}
+	if err := checkHandleAvailable(tx, handle, userID); err != nil {
+		return err
+	}
+
+	changedAtValue := changedAt
+	if renamed {
+		changedAtValue = sql.NullTime{Time: now, Valid: true}
+	}
+	if _, err := tx.Exec(`UPDATE users SET handle = ?, handle_changed_at = ?, updated_at = ? WHERE id = ?`,
+		handle, changedAtValue, now, userID); err != nil {
+		return fmt.Errorf("failed to update handle: %w", err)
+	}
+
+	// Users taking back one of their former handles no longer need its redirect
+	if _, err := tx.Exec(`DELETE FROM handle_redirects WHERE handle = ?`, handle); err != nil {
+		return fmt.Errorf("failed to remove handle redirect: %w", err)
+	}
+	if renamed {
+		if _, err := tx.Exec(`INSERT INTO handle_redirects (handle, user_id, expires_at, created_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (handle) DO UPDATE SET user_id = excluded.user_id, expires_at = excluded.expires_at, created_at = excluded.created_at`,
+			current.String, userID, now.Add(HandleRedirectPeriod), now); err != nil {
+			return fmt.Errorf("failed to add handle redirect: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ResolveHandle returns the user a handle points to and their current
+// handle. redirected is set when handle is a former handle of the user.
+func ResolveHandle(handle string) (userID int, current string, redirected bool, err error) {
+	err = db.DB.QueryRow(`SELECT id, handle FROM users WHERE handle = ? COLLATE NOCASE`, handle).Scan(&userID, &current)
+	if err == nil {
+		return userID, current, false, nil
+	} else if err != sql.ErrNoRows {
+		return 0, "", false, fmt.Errorf("failed to resolve handle: %w", err)
+	}
+
+	err = db.DB.QueryRow(`SELECT u.id, u.handle FROM handle_redirects hr JOIN users u ON u.id = hr.user_id
+		WHERE hr.handle = ? AND hr.expires_at > ? AND u.handle IS NOT NULL`, handle, time.Now().UTC()).Scan(&userID, &current)
+	if err == sql.ErrNoRows {
+		return 0, "", false, ErrProfileNotFound
+	} else if err != nil {
+		return 0, "", false, fmt.Errorf("failed to resolve handle: %w", err)
+	}
+	return userID, current, true, nil
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"Social/pkg/models"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// maxImagePixels bounds the size of decoded images, so that a small file
+	// declaring huge dimensions cannot exhaust memory
+	maxImagePixels = 50_000_000
+
+	jpegQuality = 85
+)
+
+// imageVariantSizes lists the variants produced for each uploaded image, from
+// the largest to the smallest. Images are scaled down to fit in a square of
+// the given size and never scaled up.
+var imageVariantSizes = []struct {
+	name    string
+	maxSize int
+}{
+	{models.MediaVariantFull, 2048},
+	{models.MediaVariantFeed, 800},
+	{models.MediaVariantThumb, 200},
+}
+
+var errImageTooLarge = errors.New("image dimensions are too large")
+
+// imageVariant is one encoded variant of a processed image
+type imageVariant struct {
+	name          string
+	data          []byte
+	contentType   string
+	width, height int
+}
+
+// processedImage holds the variants of an uploaded image along with the size
+// of the full variant and its blur placeholder
+type processedImage struct {
+	variants      []imageVariant
+	width, height int
+	blurhash      string
+}
+
+// processImage decodes an uploaded image and re-encodes it into its variants.
+// Re-encoding drops all metadata, such as EXIF location data; the EXIF
+// orientation of JPEG photos is applied to the pixels first. Animated GIFs
+// keep their animation in the full variant. WebP images cannot be decoded
+// with the standard library, so they are only stripped of their metadata
+// and kept as their single full variant.
+func processImage(data []byte, contentType string) (processedImage, error) {
+	if contentType == "image/webp" {
+		stripped, err := stripWebPMetadata(data)
+		if err != nil {
+			return processedImage{}, err
+		}
+		return processedImage{variants: []imageVariant{{name: models.MediaVariantFull, data: stripped, contentType: contentType}}}, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return processedImage{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+	if config.Width*config.Height > maxImagePixels {
+		return processedImage{}, errImageTooLarge
+	}
+
+	var src image.Image
+	var animation *gif.GIF
+	switch contentType {
+	case "image/jpeg":
+		if src, err = jpeg.Decode(bytes.NewReader(data)); err == nil {
+			src = orientImage(toRGBA(src), jpegOrientation(data))
+		}
+	case "image/png":
+		src, err = png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		if animation, err = gif.DecodeAll(bytes.NewReader(data)); err == nil {
+			src = animation.Image[0]
+		}
+	default:
+		return processedImage{}, fmt.Errorf("cannot process images of type %s", contentType)
+	}
+	if err != nil {
+		return processedImage{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	// Photos stay JPEG; everything else becomes PNG to keep transparency
+	encodeType := "image/png"
+	if contentType == "image/jpeg" {
+		encodeType = "image/jpeg"
+	}
+
+	var result processedImage
+	current := toRGBA(src)
+	for _, size := range imageVariantSizes {
+		// Each variant is scaled down from the previous, larger one
+		current = fitImage(current, size.maxSize)
+		variant := imageVariant{name: size.name, contentType: encodeType,
+			width: current.Bounds().Dx(), height: current.Bounds().Dy()}
+
+		if size.name == models.MediaVariantFull && animation != nil && len(animation.Image) > 1 {
+			// Animations are kept whole rather than resized frame by frame
+			variant.contentType = "image/gif"
+			variant.width, variant.height = animation.Config.Width, animation.Config.Height
+			variant.data, err = encodeGIF(animation)
+		} else {
+			variant.data, err = encodeImage(current, encodeType)
+		}
+		if err != nil {
+			return processedImage{}, err
+		}
+
+		if size.name == models.MediaVariantFull {
+			result.width, result.height = variant.width, variant.height
+		}
+		if size.name == models.MediaVariantThumb {
+			result.blurhash = blurhash(current, 4, 3)
+		}
+		result.variants = append(result.variants, variant)
+	}
+	return result, nil
+}
+
+func encodeImage(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeGIF re-encodes an animation, which keeps its frames, timing and
+// looping but none of its comment or application extensions
+func encodeGIF(animation *gif.GIF) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// toRGBA returns img as an RGBA image whose bounds start at the origin
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// fitImage scales img down to fit in a maxSize square, averaging the source
+// pixels covered by each destination pixel. Smaller images are returned as is.
+func fitImage(img *image.RGBA, maxSize int) *image.RGBA {
+	srcW, srcH := img.Rect.Dx(), img.Rect.Dy()
+	if srcW <= maxSize && srcH <= maxSize {
+		return img
+	}
+
+	dstW, dstH := maxSize, maxSize
+	if srcW > srcH {
+		dstH = maxInt(1, srcH*maxSize/srcW)
+	} else {
+		dstW = maxInt(1, srcW*maxSize/srcH)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0, y1 := y*srcH/dstH, maxInt((y+1)*srcH/dstH, y*srcH/dstH+1)
+		for x := 0; x < dstW; x++ {
+			x0, x1 := x*srcW/dstW, maxInt((x+1)*srcW/dstW, x*srcW/dstW+1)
+
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				row := img.Pix[sy*img.Stride+x0*4 : sy*img.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					r += int(row[i])
+					g += int(row[i+1])
+					b += int(row[i+2])
+					a += int(row[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// orientImage rotates and flips img so that it displays upright, given its
+// EXIF orientation from 1 (already upright) to 8
+func orientImage(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dstW, dstH := w, h
+	if orientation >= 5 {
+		dstW, dstH = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // mirrored along the top-right diagonal
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counterclockwise to display
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], img.Pix[img.PixOffset(x, y):img.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation of a JPEG file, or 1 when it
+// has none or it cannot be read
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	// Walk the segments before the image data looking for the EXIF one
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// exifOrientation reads the orientation tag from the first directory of a
+// TIFF structure, as embedded in the EXIF segment of a JPEG file
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:8]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset : offset+2]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8 : entry+10]))
+		}
+	}
+	return 1
+}
+
+// stripWebPMetadata removes the EXIF and XMP chunks of a WebP file, along
+// with the flags announcing them in its extended header
+func stripWebPMetadata(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid WebP file")
+	}
+
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i+8 <= len(data); {
+		fourCC := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		end := i + 8 + size + size%2 // chunks are padded to an even size
+		if end > len(data) {
+			return nil, errors.New("invalid WebP file")
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04 // EXIF and XMP flags
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:8], uint32(len(out)-8))
+	return out, nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"fmt"
+)
+
+// postColumns selects a post aliased as p in the order scanPost expects
+const postColumns = `p.id, p.user_id, p.content, COALESCE(p.image, ''), p.privacy, p.created_at, p.updated_at, p.comment_count,
+	p.media_id, p.group_id`
+
+func scanPost(row rowScanner, extra ...interface{}) (models.Post, error) {
+	var post models.Post
+	var mediaID, groupID sql.NullInt64
+	dest := []interface{}{&post.ID, &post.UserID, &post.Content, &post.Image, &post.Privacy,
+		&post.CreatedAt, &post.UpdatedAt, &post.CommentCount, &mediaID, &groupID}
+	err := row.Scan(append(dest, extra...)...)
+	post.MediaID = nullableID(mediaID)
+	post.GroupID = nullableID(groupID)
+	return post, err
+}
+
+// userSummaryColumns selects the public card of a user aliased as u in the
+// order scanUserSummary expects. The nickname must go through
+// redactUserSummaries before the card is shown to someone else.
+const userSummaryColumns = `u.id, COALESCE(u.first_name, ''), COALESCE(u.last_name, ''), COALESCE(u.nickname, ''), COALESCE(u.avatar, ''), u.is_private,
+	COALESCE(u.handle, ''), u.nickname_visibility`
+
+func scanUserSummary(row rowScanner, extra ...interface{}) (models.UserSummary, error) {
+	var user models.UserSummary
+	dest := []interface{}{&user.ID, &user.FirstName, &user.LastName, &user.Nickname, &user.Avatar, &user.IsPrivate,
+		&user.Handle, &user.NicknameVisibility}
+	err := row.Scan(append(dest, extra...)...)
+	return user, err
+}
+
+// loadUserSummaries fetches in one query the public cards of the given users,
+// as viewerID may see them
+func loadUserSummaries(viewerID int, userIDs []int) (map[int]models.UserSummary, error) {
+	users := make(map[int]models.UserSummary, len(userIDs))
+	ids := uniqueIDs(userIDs)
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.DB.Query(`SELECT `+userSummaryColumns+` FROM users u WHERE u.id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load users: %w", err)
+	}
+	defer rows.Close()
+
+	var loaded []*models.UserSummary
+	for rows.Next() {
+		user, err := scanUserSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		loaded = append(loaded, &user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over users: %w", err)
+	}
+
+	if err := redactUserSummaries(viewerID, loaded); err != nil {
+		return nil, err
+	}
+	for _, user := range loaded {
+		users[user.ID] = *user
+	}
+	return users, nil
+}
+
+// loadPosts fills in the reactions and authors of a page of posts, and their
+// comments when withComments is set. It runs the same number of queries
+// whatever the number of posts: one for the comments, two for the reactions
+// of the posts, two for the reactions of the comments, one for the images of
+// the posts and one for the authors of both posts and comments.
+func loadPosts(viewerID int, posts []models.Post, withComments bool) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	var comments []models.Comment
+	if withComments {
+		var err error
+		comments, err = loadComments(viewerID, posts)
+		if err != nil {
+			return err
+		}
+		mutes, err := loadMuteFilter(viewerID)
+		if err != nil {
+			return err
+		}
+		comments = mutes.filterComments(comments)
+		if err := attachCommentReactions(viewerID, comments); err != nil {
+			return err
+		}
+	}
+
+	if err := attachPostReactions(viewerID, posts); err != nil {
+		return err
+	}
+
+	mediaIDs := make([]int, 0, len(posts))
+	for _, post := range posts {
+		if post.MediaID != nil {
+			mediaIDs = append(mediaIDs, *post.MediaID)
+		}
+	}
+	images, err := loadMediaImages(mediaIDs)
+	if err != nil {
+		return err
+	}
+
+	authorIDs := make([]int, 0, len(posts)+len(comments))
+	for _, post := range posts {
+		authorIDs = append(authorIDs, post.UserID)
+	}
+	for _, comment := range comments {
+		authorIDs = append(authorIDs, comment.UserID)
+	}
+	authors, err := loadUserSummaries(viewerID, authorIDs)
+	if err != nil {
+		return err
+	}
+
+	postComments := make(map[int][]models.Comment, len(posts))
+	for _, comment := range comments {
+		comment.Author = userSummaryOf(authors, comment.UserID)
+		postComments[comment.PostID] = append(postComments[comment.PostID], comment)
+	}
+	for i := range posts {
+		posts[i].Author = userSummaryOf(authors, posts[i].UserID)
+		posts[i].MediaImage = mediaImageOf(images, posts[i].MediaID)
+		if withComments {
+			posts[i].Comments = postComments[posts[i].ID]
+		}
+	}
+	return nil
+}
+
+// loadComments fetches in one query the comments of all the given posts
+// visible to viewerID, in the order they were written
+func loadComments(viewerID int, posts []models.Post) ([]models.Comment, error) {
+	visible, args := commentVisibilityCondition(viewerID)
+	for _, post := range posts {
+		args = append(args, post.ID)
+	}
+	rows, err := db.DB.Query(`SELECT `+commentColumns+` FROM comments c
+		WHERE `+visible+` AND c.post_id IN (`+placeholders(len(posts))+`) ORDER BY c.id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load comments: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []models.Comment
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment: %w", err)
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// attachCommentAuthors fills in the authors of comments, as viewerID may see
+// them, in one query. Tombstones have no author.
+func attachCommentAuthors(viewerID int, comments []models.Comment) error {
+	authorIDs := make([]int, len(comments))
+	for i, comment := range comments {
+		authorIDs[i] = comment.UserID
+	}
+	authors, err := loadUserSummaries(viewerID, authorIDs)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Author = userSummaryOf(authors, comments[i].UserID)
+	}
+	return nil
+}
+
+// userSummaryOf returns the card of userID if it was loaded
+func userSummaryOf(users map[int]models.UserSummary, userID int) *models.UserSummary {
+	user, ok := users[userID]
+	if !ok {
+		return nil
+	}
+	return &user
+}
+
+// uniqueIDs returns the positive IDs of ids without duplicates, in their first order
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	var unique []int
+	for _, id := range ids {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
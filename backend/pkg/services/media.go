@@ -0,0 +1,254 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"Social/pkg/storage"
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxMediaSize is the largest upload accepted when MEDIA_MAX_BYTES is not set
+const DefaultMaxMediaSize = 10 << 20
+
+var (
+	ErrMediaTooLarge        = errors.New("file is too large")
+	ErrUnsupportedMediaType = errors.New("file type is not supported, upload a JPEG, PNG, GIF or WebP image")
+	ErrInvalidMedia         = errors.New("media not found or not uploaded by this user")
+)
+
+// mediaExtensions maps the content types accepted for uploads, as sniffed
+// from their first bytes, to the extension of their stored file
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// mediaStore holds the bytes of uploaded media, set once at startup
+var mediaStore storage.BlobStore
+
+// SetMediaStore sets where uploaded media are stored
+func SetMediaStore(store storage.BlobStore) {
+	mediaStore = store
+}
+
+// MaxMediaSize returns the largest upload accepted in bytes, read from the
+// MEDIA_MAX_BYTES environment variable
+func MaxMediaSize() int64 {
+	if size, err := strconv.ParseInt(os.Getenv("MEDIA_MAX_BYTES"), 10, 64); err == nil && size > 0 {
+		return size
+	}
+	return DefaultMaxMediaSize
+}
+
+// mediaUpload is an upload whose size and type have been checked
+type mediaUpload struct {
+	data        []byte
+	contentType string
+}
+
+// readMedia reads an upload, rejecting it when it is over MaxMediaSize or its
+// content is not one of the supported types. The type is sniffed from the
+// content itself; the file name and type sent by the client are ignored.
+func readMedia(r io.Reader) (mediaUpload, error) {
+	maxSize := MaxMediaSize()
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return mediaUpload{}, fmt.Errorf("failed to read upload: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return mediaUpload{}, ErrMediaTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if _, ok := mediaExtensions[contentType]; !ok {
+		return mediaUpload{}, ErrUnsupportedMediaType
+	}
+	return mediaUpload{data: data, contentType: contentType}, nil
+}
+
+// newStorageKey returns a random name for a stored file of the given type
+func newStorageKey(contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate media name: %w", err)
+	}
+	return hex.EncodeToString(b) + mediaExtensions[contentType], nil
+}
+
+// storeMedia writes a checked upload of ownerID to the blob store and records
+// it with tx. The blob is removed again when it cannot be recorded.
+func storeMedia(tx *sql.Tx, ownerID int, upload mediaUpload) (models.Media, error) {
+	media := models.Media{
+		OwnerID:     ownerID,
+		ContentType: upload.contentType,
+		Size:        int64(len(upload.data)),
+		Status:      models.MediaStatusPending,
+		CreatedAt:   time.Now(),
+	}
+	if mediaStore == nil {
+		return media, errors.New("media storage is not configured")
+	}
+
+	key, err := newStorageKey(upload.contentType)
+	if err != nil {
+		return media, err
+	}
+	if err := mediaStore.Put(key, bytes.NewReader(upload.data)); err != nil {
+		return media, fmt.Errorf("failed to store media: %w", err)
+	}
+	media.StorageKey = key
+
+	res, err := tx.Exec(`INSERT INTO media (owner_id, storage_key, content_type, size, created_at) VALUES (?, ?, ?, ?, ?)`,
+		media.OwnerID, media.StorageKey, media.ContentType, media.Size, media.CreatedAt)
+	if err != nil {
+		mediaStore.Delete(key)
+		return media, fmt.Errorf("failed to record media: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		mediaStore.Delete(key)
+		return media, fmt.Errorf("failed to retrieve media ID: %w", err)
+	}
+	media.ID = int(id)
+	return media, nil
+}
+
+// UploadMedia checks and stores a file uploaded by ownerID and returns the
+// media it can be referenced by. The upload is then processed into its
+// variants in the background.
+func UploadMedia(ownerID int, r io.Reader) (models.Media, error) {
+	upload, err := readMedia(r)
+	if err != nil {
+		return models.Media{}, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.Media{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	media, err := storeMedia(tx, ownerID, upload)
+	if err != nil {
+		return media, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		mediaStore.Delete(media.StorageKey)
+		return media, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	enqueueMedia(media.ID)
+	return media, nil
+}
+
+// checkMediaOwner returns ErrInvalidMedia unless mediaID, when set, is a
+// media uploaded by ownerID. Users may only attach their own uploads.
+func checkMediaOwner(q queryRower, ownerID int, mediaID *int) error {
+	if mediaID == nil {
+		return nil
+	}
+	var owned bool
+	err := q.QueryRow(`SELECT EXISTS(SELECT 1 FROM media WHERE id = ? AND owner_id = ?)`, *mediaID, ownerID).Scan(&owned)
+	if err != nil {
+		return fmt.Errorf("failed to check media: %w", err)
+	}
+	if !owned {
+		return ErrInvalidMedia
+	}
+	return nil
+}
+
+// nullableID returns the ID scanned into id, or nil when it is NULL
+func nullableID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	value := int(id.Int64)
+	return &value
+}
+
+// mediaVariantURL returns the URL a variant of a media is served at
+func mediaVariantURL(mediaID int, variant string) string {
+	return "/media/" + strconv.Itoa(mediaID) + "/" + variant
+}
+
+// loadMediaImages fetches in one query the processed images of the given
+// media, with the signed URLs of their variants once they are ready. Only
+// use it for media the viewer is allowed to see.
+func loadMediaImages(mediaIDs []int) (map[int]*models.MediaImage, error) {
+	images := make(map[int]*models.MediaImage, len(mediaIDs))
+	ids := uniqueIDs(mediaIDs)
+	if len(ids) == 0 {
+		return images, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := db.DB.Query(`SELECT m.id, m.status, m.width, m.height, m.blurhash, COALESCE(v.name, '')
+		FROM media m LEFT JOIN media_variants v ON v.media_id = m.id
+		WHERE m.id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load media: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var image models.MediaImage
+		var variant string
+		if err := rows.Scan(&image.ID, &image.Status, &image.Width, &image.Height, &image.Blurhash, &variant); err != nil {
+			return nil, fmt.Errorf("failed to scan media: %w", err)
+		}
+		if _, ok := images[image.ID]; !ok {
+			images[image.ID] = &image
+		}
+		if image.Status != models.MediaStatusReady {
+			continue
+		}
+		url := SignedMediaURL(image.ID, variant)
+		switch variant {
+		case models.MediaVariantThumb:
+			images[image.ID].ThumbURL = url
+		case models.MediaVariantFeed:
+			images[image.ID].FeedURL = url
+		case models.MediaVariantFull:
+			images[image.ID].FullURL = url
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over media: %w", err)
+	}
+
+	// Images that could not be resized, such as WebP ones, only have their
+	// full variant
+	for _, image := range images {
+		if image.ThumbURL == "" {
+			image.ThumbURL = image.FullURL
+		}
+		if image.FeedURL == "" {
+			image.FeedURL = image.FullURL
+		}
+	}
+	return images, nil
+}
+
+// mediaImageOf returns the loaded image of mediaID, or nil when it has none
+func mediaImageOf(images map[int]*models.MediaImage, mediaID *int) *models.MediaImage {
+	if mediaID == nil {
+		return nil
+	}
+	return images[*mediaID]
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// SignedMediaURLLifetime is how long signed media URLs stay valid at least
+	SignedMediaURLLifetime = time.Hour
+
+	// signedMediaURLWindow rounds up expiry times, so that the URLs handed out
+	// in the meantime are the same and can be cached by browsers
+	signedMediaURLWindow = 15 * time.Minute
+)
+
+var (
+	ErrMediaNotFound    = errors.New("media not found")
+	ErrInvalidSignature = errors.New("invalid or expired media signature")
+)
+
+var (
+	mediaURLSecret     []byte
+	mediaURLSecretOnce sync.Once
+)
+
+// mediaSigningKey returns the key signed media URLs are signed with, read
+// from the MEDIA_URL_SECRET environment variable. Without it a random key is
+// used, and signed URLs stop working when the server restarts.
+func mediaSigningKey() []byte {
+	mediaURLSecretOnce.Do(func() {
+		if secret := os.Getenv("MEDIA_URL_SECRET"); secret != "" {
+			mediaURLSecret = []byte(secret)
+			return
+		}
+		log.Println("MEDIA_URL_SECRET is not set, signed media URLs will not survive a restart")
+		mediaURLSecret = make([]byte, 32)
+		if _, err := rand.Read(mediaURLSecret); err != nil {
+			log.Fatalf("Failed to generate media URL secret: %v", err)
+		}
+	})
+	return mediaURLSecret
+}
+
+func mediaSignature(mediaID int, variant string, expires int64) string {
+	mac := hmac.New(sha256.New, mediaSigningKey())
+	fmt.Fprintf(mac, "%d/%s/%d", mediaID, variant, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedMediaURL returns a URL giving access to a variant of a media without
+// a session until it expires. Only hand it to users who may see the media.
+func SignedMediaURL(mediaID int, variant string) string {
+	expires := time.Now().Add(SignedMediaURLLifetime).Truncate(signedMediaURLWindow).Add(signedMediaURLWindow).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("sig", mediaSignature(mediaID, variant, expires))
+	return mediaVariantURL(mediaID, variant) + "?" + query.Encode()
+}
+
+// VerifyMediaSignature checks the signature of a signed media URL and returns
+// when it expires
+func VerifyMediaSignature(mediaID int, variant, expiresStr, signature string) (time.Time, error) {
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidSignature
+	}
+	expiresAt := time.Unix(expires, 0)
+	if !time.Now().Before(expiresAt) {
+		return time.Time{}, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(mediaSignature(mediaID, variant, expires))) {
+		return time.Time{}, ErrInvalidSignature
+	}
+	return expiresAt, nil
+}
+
+// requireVisibleMedia hides media behind ErrNotFound unless userID uploaded
+// it or may see something it is attached to: a post, a comment on a post, the
+// avatar of a user or a message of a conversation they take part in
+func requireVisibleMedia(userID, mediaID int) error {
+	visiblePost, postArgs := postVisibilityCondition(userID)
+	commentAuthorNotBlocked, commentArgs := blockCondition(userID, "c.user_id")
+	avatarOwnerNotBlocked, avatarArgs := blockCondition(userID, "u.id")
+
+	args := []interface{}{userID}
+	args = append(args, postArgs...)
+	args = append(args, postArgs...)
+	args = append(args, commentArgs...)
+	args = append(args, avatarArgs...)
+	args = append(args, userID, userID, userID, mediaID)
+
+	var visible bool
+	err := db.DB.QueryRow(`SELECT m.owner_id = ?
+		OR EXISTS (SELECT 1 FROM posts p WHERE p.media_id = m.id AND `+visiblePost+`)
+		OR EXISTS (SELECT 1 FROM comments c JOIN posts p ON p.id = c.post_id
+			WHERE c.media_id = m.id AND c.deleted_at IS NULL AND `+visiblePost+` AND `+commentAuthorNotBlocked+`)
+		OR EXISTS (SELECT 1 FROM users u WHERE u.avatar_media_id = m.id AND `+avatarOwnerNotBlocked+`)
+		OR EXISTS (SELECT 1 FROM chats ch WHERE ch.media_id = m.id AND (
+			(ch.is_group AND EXISTS (SELECT 1 FROM group_memberships gm
+				WHERE gm.group_id = ch.group_id AND gm.user_id = ? AND gm.left_at IS NULL))
+			OR (NOT ch.is_group AND (ch.sender_id = ? OR ch.recipient_id = ?))))
+		FROM media m WHERE m.id = ?`, args...).Scan(&visible)
+	if err != nil {
+		return notFoundOr(err, "failed to check media visibility")
+	}
+	if !visible {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MediaFile is an open variant of a media, ready to be served
+type MediaFile struct {
+	io.ReadSeekCloser
+	ContentType string
+	ETag        string
+	ModTime     time.Time
+}
+
+// OpenMedia opens a variant of a processed media. Media still being processed
+// are not served, as their original upload may carry metadata.
+func OpenMedia(mediaID int, variant string) (*MediaFile, error) {
+	switch variant {
+	case models.MediaVariantThumb, models.MediaVariantFeed, models.MediaVariantFull:
+	default:
+		return nil, ErrMediaNotFound
+	}
+
+	var key, contentType string
+	var createdAt time.Time
+	// Images that could not be resized only have their full variant
+	err := db.DB.QueryRow(`SELECT v.storage_key, v.content_type, m.created_at
+		FROM media m JOIN media_variants v ON v.media_id = m.id
+		WHERE m.id = ? AND m.status = ? AND v.name IN (?, ?)
+		ORDER BY v.name = ? DESC LIMIT 1`,
+		mediaID, models.MediaStatusReady, variant, models.MediaVariantFull, variant).Scan(&key, &contentType, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMediaNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to look up media: %w", err)
+	}
+
+	blob, err := mediaStore.Open(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open media: %w", err)
+	}
+	// Stored files are never overwritten, so their key identifies their content
+	return &MediaFile{ReadSeekCloser: blob, ContentType: contentType, ETag: `"` + key + `"`, ModTime: createdAt}, nil
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMediaWorkers is the number of uploads processed at once when
+	// MEDIA_WORKERS is not set
+	DefaultMediaWorkers = 2
+
+	// mediaSweepInterval is how often uploads left pending, because the queue
+	// was full or processing failed on a temporary error, are queued again
+	mediaSweepInterval = time.Minute
+)
+
+// mediaQueue holds the IDs of the uploads waiting to be processed
+var mediaQueue = make(chan int, 256)
+
+// errMediaUnreadable marks uploads that will never process, such as corrupt
+// images, as opposed to temporary storage or database errors
+var errMediaUnreadable = errors.New("media cannot be processed")
+
+// MediaWorkers returns the number of uploads processed at once, read from the
+// MEDIA_WORKERS environment variable
+func MediaWorkers() int {
+	if workers, err := strconv.Atoi(os.Getenv("MEDIA_WORKERS")); err == nil && workers > 0 {
+		return workers
+	}
+	return DefaultMediaWorkers
+}
+
+// StartMediaWorkers starts the background processing of uploads with the
+// given number of workers. Uploads interrupted by a restart are processed
+// again from the start.
+func StartMediaWorkers(workers int) {
+	if _, err := db.DB.Exec(`UPDATE media SET status = ? WHERE status = ?`,
+		models.MediaStatusPending, models.MediaStatusProcessing); err != nil {
+		log.Printf("Failed to requeue interrupted media: %v", err)
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for mediaID := range mediaQueue {
+				if err := processMedia(mediaID); err != nil {
+					log.Printf("Failed to process media %d: %v", mediaID, err)
+				}
+			}
+		}()
+	}
+	go sweepPendingMedia()
+}
+
+// enqueueMedia queues an upload for processing without waiting. When the
+// queue is full the upload stays pending until the next sweep.
+func enqueueMedia(mediaID int) {
+	select {
+	case mediaQueue <- mediaID:
+	default:
+		log.Printf("Media queue is full, media %d will be processed later", mediaID)
+	}
+}
+
+// sweepPendingMedia regularly queues the uploads still waiting to be processed
+func sweepPendingMedia() {
+	for {
+		rows, err := db.DB.Query(`SELECT id FROM media WHERE status = ? ORDER BY id`, models.MediaStatusPending)
+		if err != nil {
+			log.Printf("Failed to look up pending media: %v", err)
+		} else {
+			var ids []int
+			for rows.Next() {
+				var id int
+				if err := rows.Scan(&id); err == nil {
+					ids = append(ids, id)
+				}
+			}
+			rows.Close()
+			for _, id := range ids {
+				enqueueMedia(id)
+			}
+		}
+		time.Sleep(mediaSweepInterval)
+	}
+}
+
+// processMedia turns an upload into its variants. The upload is claimed first
+// so that it is only processed once even when queued several times.
+func processMedia(mediaID int) error {
+	res, err := db.DB.Exec(`UPDATE media SET status = ? WHERE id = ? AND status = ?`,
+		models.MediaStatusProcessing, mediaID, models.MediaStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to claim media: %w", err)
+	}
+	if claimed, err := res.RowsAffected(); err != nil || claimed == 0 {
+		return err
+	}
+
+	err = storeMediaVariants(mediaID)
+	if err != nil {
+		// Temporary errors leave the upload to the next sweep
+		status := models.MediaStatusPending
+		if errors.Is(err, errMediaUnreadable) {
+			status = models.MediaStatusFailed
+		}
+		if _, updateErr := db.DB.Exec(`UPDATE media SET status = ? WHERE id = ?`, status, mediaID); updateErr != nil {
+			log.Printf("Failed to update status of media %d: %v", mediaID, updateErr)
+		}
+	}
+	return err
+}
+
+// storeMediaVariants stores the variants of an upload and records them. The
+// media then points to its full variant, and the original upload, which may
+// carry metadata such as location data, is deleted.
+func storeMediaVariants(mediaID int) error {
+	var originalKey, contentType string
+	err := db.DB.QueryRow(`SELECT storage_key, content_type FROM media WHERE id = ?`, mediaID).Scan(&originalKey, &contentType)
+	if err != nil {
+		return fmt.Errorf("failed to look up media: %w", err)
+	}
+
+	blob, err := mediaStore.Open(originalKey)
+	if err != nil {
+		return fmt.Errorf("failed to open media: %w", err)
+	}
+	data, err := io.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read media: %w", err)
+	}
+
+	processed, err := processImage(data, contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errMediaUnreadable, err)
+	}
+
+	// Variants stored before a failure are not referenced by anything
+	var storedKeys []string
+	committed := false
+	defer func() {
+		if !committed {
+			for _, key := range storedKeys {
+				mediaStore.Delete(key)
+			}
+		}
+	}()
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var fullKey string
+	var fullVariant imageVariant
+	for _, variant := range processed.variants {
+		key, err := newStorageKey(variant.contentType)
+		if err != nil {
+			return err
+		}
+		if err := mediaStore.Put(key, bytes.NewReader(variant.data)); err != nil {
+			return fmt.Errorf("failed to store media variant: %w", err)
+		}
+		storedKeys = append(storedKeys, key)
+
+		if _, err := tx.Exec(`INSERT INTO media_variants (media_id, name, storage_key, content_type, width, height, size)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			mediaID, variant.name, key, variant.contentType, variant.width, variant.height, len(variant.data)); err != nil {
+			return fmt.Errorf("failed to record media variant: %w", err)
+		}
+		if variant.name == models.MediaVariantFull {
+			fullKey, fullVariant = key, variant
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE media SET status = ?, storage_key = ?, content_type = ?, size = ?, width = ?, height = ?, blurhash = ?
+		WHERE id = ?`, models.MediaStatusReady, fullKey, fullVariant.contentType, len(fullVariant.data),
+		processed.width, processed.height, processed.blurhash, mediaID); err != nil {
+		return fmt.Errorf("failed to update media: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	committed = true
+
+	if err := mediaStore.Delete(originalKey); err != nil {
+		log.Printf("Failed to delete original of media %d: %v", mediaID, err)
+	}
+	return nil
+}
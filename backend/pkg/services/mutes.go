@@ -0,0 +1,267 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// MaxMuteKeywordLength is the longest word or phrase that can be muted, in characters
+const MaxMuteKeywordLength = 100
+
+var (
+	ErrInvalidMuteTarget = errors.New("target type must be user, group or keyword")
+	ErrInvalidKeyword    = errors.New("keyword must be between 1 and 100 characters")
+	ErrInvalidDuration   = errors.New("duration must be positive")
+	ErrMuteSelf          = errors.New("you cannot mute yourself")
+	ErrMuteNotFound      = errors.New("mute not found")
+)
+
+// MuteTarget mutes a user, a group or a keyword for userID. A zero duration
+// mutes until the mute is removed. Muting the same thing again replaces the
+// expiry of the previous mute.
+func MuteTarget(userID int, mute models.Mute, duration time.Duration) (models.Mute, error) {
+	mute.UserID = userID
+	mute.CreatedAt = time.Now()
+
+	switch mute.TargetType {
+	case models.MuteTargetUser:
+		if mute.TargetID == userID {
+			return mute, ErrMuteSelf
+		}
+		if err := requireExists(`SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)`, mute.TargetID, ErrUserNotFound); err != nil {
+			return mute, err
+		}
+		mute.Keyword = ""
+	case models.MuteTargetGroup:
+		if err := requireVisibleGroup(userID, mute.TargetID); err != nil {
+			return mute, err
+		}
+		mute.Keyword = ""
+	case models.MuteTargetKeyword:
+		mute.TargetID = 0
+		mute.Keyword = strings.ToLower(strings.Join(strings.Fields(mute.Keyword), " "))
+		if mute.Keyword == "" || utf8.RuneCountInString(mute.Keyword) > MaxMuteKeywordLength {
+			return mute, ErrInvalidKeyword
+		}
+	default:
+		return mute, ErrInvalidMuteTarget
+	}
+
+	if duration < 0 {
+		return mute, ErrInvalidDuration
+	}
+	mute.ExpiresAt = nil
+	if duration > 0 {
+		expiresAt := mute.CreatedAt.UTC().Add(duration)
+		mute.ExpiresAt = &expiresAt
+	}
+
+	err := db.DB.QueryRow(`INSERT INTO mutes (user_id, target_type, target_id, keyword, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, target_type, target_id, keyword) DO UPDATE SET expires_at = excluded.expires_at, created_at = excluded.created_at
+		RETURNING id`,
+		mute.UserID, mute.TargetType, mute.TargetID, mute.Keyword, mute.ExpiresAt, mute.CreatedAt).Scan(&mute.ID)
+	if err != nil {
+		return mute, fmt.Errorf("failed to save mute: %w", err)
+	}
+	return mute, nil
+}
+
+// ListMutes returns the mutes of userID that have not expired, newest first
+func ListMutes(userID int) ([]models.Mute, error) {
+	rows, err := db.DB.Query(`SELECT id, user_id, target_type, target_id, keyword, expires_at, created_at
+		FROM mutes WHERE user_id = ? AND (expires_at IS NULL OR expires_at > ?)
+		ORDER BY created_at DESC, id DESC`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mutes: %w", err)
+	}
+	defer rows.Close()
+
+	var mutes []models.Mute
+	for rows.Next() {
+		var mute models.Mute
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&mute.ID, &mute.UserID, &mute.TargetType, &mute.TargetID, &mute.Keyword,
+			&expiresAt, &mute.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mute: %w", err)
+		}
+		if expiresAt.Valid {
+			mute.ExpiresAt = &expiresAt.Time
+		}
+		mutes = append(mutes, mute)
+	}
+	return mutes, rows.Err()
+}
+
+// Unmute removes one of the mutes of userID
+func Unmute(userID, muteID int) error {
+	res, err := db.DB.Exec(`DELETE FROM mutes WHERE id = ? AND user_id = ?`, muteID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove mute: %w", err)
+	}
+
+	affectedRows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows: %w", err)
+	}
+	if affectedRows == 0 {
+		return ErrMuteNotFound
+	}
+	return nil
+}
+
+// requireExists runs a SELECT EXISTS query over id and returns notFound when it does not hold
+func requireExists(query string, id int, notFound error) error {
+	var exists bool
+	if err := db.DB.QueryRow(query, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to look up resource: %w", err)
+	}
+	if !exists {
+		return notFound
+	}
+	return nil
+}
+
+// mutedUserCondition returns an SQL condition that only holds when viewerID
+// has not muted the user in userColumn, with its arguments
+func mutedUserCondition(viewerID int, userColumn string) (string, []interface{}) {
+	condition := userColumn + ` NOT IN (SELECT target_id FROM mutes
+		WHERE user_id = ? AND target_type = ? AND (expires_at IS NULL OR expires_at > ?))`
+	return condition, []interface{}{viewerID, models.MuteTargetUser, time.Now().UTC()}
+}
+
+// muteFilter holds the active mutes of a user. The user's own posts and
+// comments are never hidden from them.
+type muteFilter struct {
+	userID   int
+	users    map[int]bool
+	groups   map[int]bool
+	keywords []*regexp.Regexp
+}
+
+// loadMuteFilter reads the active mutes of userID
+func loadMuteFilter(userID int) (muteFilter, error) {
+	filter := muteFilter{userID: userID, users: map[int]bool{}, groups: map[int]bool{}}
+
+	mutes, err := ListMutes(userID)
+	if err != nil {
+		return filter, err
+	}
+	for _, mute := range mutes {
+		switch mute.TargetType {
+		case models.MuteTargetUser:
+			filter.users[mute.TargetID] = true
+		case models.MuteTargetGroup:
+			filter.groups[mute.TargetID] = true
+		case models.MuteTargetKeyword:
+			filter.keywords = append(filter.keywords, keywordPattern(mute.Keyword))
+		}
+	}
+	return filter, nil
+}
+
+// keywordPattern matches a word or phrase as whole words, ignoring case and
+// allowing any spacing between the words of a phrase
+func keywordPattern(keyword string) *regexp.Regexp {
+	words := strings.Fields(keyword)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])` + strings.Join(words, `\s+`) + `(?:$|[^\p{L}\p{N}_])`)
+}
+
+// matchesKeyword reports whether text contains one of the muted keywords
+func (f muteFilter) matchesKeyword(text string) bool {
+	for _, pattern := range f.keywords {
+		if pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// hidesPost reports whether the post comes from a muted user or group, or
+// mentions a muted keyword
+func (f muteFilter) hidesPost(post models.Post) bool {
+	if post.UserID == f.userID {
+		return false
+	}
+	if post.GroupID != nil && f.groups[*post.GroupID] {
+		return true
+	}
+	return f.users[post.UserID] || f.matchesKeyword(post.Content)
+}
+
+// commentCondition returns an SQL condition over comments aliased as c that
+// hides the comments of muted users and the comments mentioning a muted
+// keyword, with its arguments. Keywords are matched by the REGEXP function of
+// the database with the same patterns as matchesKeyword.
+func (f muteFilter) commentCondition() (string, []interface{}) {
+	notMuted, args := mutedUserCondition(f.userID, "c.user_id")
+	condition := `(c.deleted_at IS NOT NULL OR c.user_id = ? OR (` + notMuted
+	args = append([]interface{}{f.userID}, args...)
+	if len(f.keywords) > 0 {
+		alternatives := make([]string, len(f.keywords))
+		for i, pattern := range f.keywords {
+			alternatives[i] = `(?:` + pattern.String() + `)`
+		}
+		condition += ` AND NOT c.content REGEXP ?`
+		args = append(args, strings.Join(alternatives, "|"))
+	}
+	return condition + `))`, args
+}
+
+// filterComments drops the comments of muted users and the comments
+// mentioning a muted keyword, along with their replies. Parents must come
+// before their replies, as they do in thread and creation order.
+func (f muteFilter) filterComments(comments []models.Comment) []models.Comment {
+	if len(f.users) == 0 && len(f.keywords) == 0 {
+		return comments
+	}
+
+	hidden := make(map[int]bool)
+	kept := comments[:0]
+	for _, comment := range comments {
+		if (comment.ParentID != nil && hidden[*comment.ParentID]) ||
+			(!comment.Deleted && comment.UserID != f.userID && (f.users[comment.UserID] || f.matchesKeyword(comment.Content))) {
+			hidden[comment.ID] = true
+			continue
+		}
+		kept = append(kept, comment)
+	}
+	return kept
+}
+
+// hidesNotification reports whether a notification is about a muted user or
+// group, as named in its details, or mentions a muted keyword
+func (f muteFilter) hidesNotification(notification models.Notification) bool {
+	for _, detail := range strings.Split(notification.Details, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(detail), ":")
+		if !found {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "group_id":
+			if f.groups[id] {
+				return true
+			}
+		case "follower_id", "inviter_id", "invitee_id", "requester_id":
+			if f.users[id] {
+				return true
+			}
+		}
+	}
+	return f.matchesKeyword(notification.Message)
+}
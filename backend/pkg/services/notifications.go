@@ -6,9 +6,16 @@ import (
 	"fmt"
 )
 
+// GetNotifications returns the notifications of userID, leaving out those
+// about the users and groups they muted or mentioning their muted keywords
 func GetNotifications(userID int) ([]models.Notification, error) {
 	var notifications []models.Notification
 
+	mutes, err := loadMuteFilter(userID)
+	if err != nil {
+		return nil, err
+	}
+
 	rows, err := db.DB.Query(`SELECT id, user_id, type, message, is_read, created_at, details FROM notifications WHERE user_id = ?`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query notifications: %w", err)
@@ -20,6 +27,9 @@ func GetNotifications(userID int) ([]models.Notification, error) {
 		if err := rows.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.Message, &notification.IsRead, &notification.CreatedAt, &notification.Details); err != nil {
 			return nil, fmt.Errorf("failed to scan notification: %w", err)
 		}
+		if mutes.hidesNotification(notification) {
+			continue
+		}
 		notifications = append(notifications, notification)
 	}
 
@@ -4,51 +4,176 @@ import (
 	"Social/pkg/db"
 	"Social/pkg/models"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
-// CreatePost inserts a new post into the database
-func CreatePost(post models.Post) error {
+var (
+	ErrPostNotFound    = errors.New("post not found")
+	ErrInvalidPrivacy  = errors.New("invalid privacy level")
+	ErrInvalidAudience = errors.New("almost private posts need an audience made of the author's followers")
+)
+
+// validPrivacy reports whether privacy is one of the supported post privacy levels
+func validPrivacy(privacy string) bool {
+	switch privacy {
+	case models.PrivacyPublic, models.PrivacyPrivate, models.PrivacyAlmostPrivate:
+		return true
+	}
+	return false
+}
+
+// postVisibilityCondition returns an SQL condition over posts aliased as p
+// that only holds for the posts viewerID is allowed to see, with its arguments.
+// Authors see all their posts, private posts are shown to followers and almost
+// private posts to the followers chosen as their audience, one by one or
+// through the current members of an audience list. Group posts ignore their
+// privacy and are shown to whoever may see the content of their group. Posts
+// of users who blocked the viewer or were blocked by them are hidden.
+func postVisibilityCondition(viewerID int) (string, []interface{}) {
+	notBlocked, blockArgs := blockCondition(viewerID, "p.user_id")
+	groupContent, groupArgs := groupContentCondition(viewerID)
+	condition := `((p.user_id = ?
+		OR (p.group_id IS NULL AND (p.privacy = ?
+		OR (p.privacy = ? AND EXISTS (
+			SELECT 1 FROM followers f WHERE f.follower_id = ? AND f.followed_id = p.user_id))
+		OR (p.privacy = ? AND EXISTS (
+			SELECT 1 FROM post_audience pa
+			JOIN followers f ON f.follower_id = pa.user_id AND f.followed_id = p.user_id
+			WHERE pa.post_id = p.id AND pa.user_id = ?))
+		OR (p.privacy = ? AND EXISTS (
+			SELECT 1 FROM post_audience_lists pal
+			JOIN audience_list_members alm ON alm.list_id = pal.list_id
+			JOIN followers f ON f.follower_id = alm.user_id AND f.followed_id = p.user_id
+			WHERE pal.post_id = p.id AND alm.user_id = ?))))
+		OR (p.group_id IS NOT NULL AND EXISTS (
+			SELECT 1 FROM groups g WHERE g.id = p.group_id AND ` + groupContent + `)))
+		AND ` + notBlocked + `)`
+	args := []interface{}{
+		viewerID,
+		models.PrivacyPublic,
+		models.PrivacyPrivate, viewerID,
+		models.PrivacyAlmostPrivate, viewerID,
+		models.PrivacyAlmostPrivate, viewerID,
+	}
+	args = append(args, groupArgs...)
+	return condition, append(args, blockArgs...)
+}
+
+// CreatePost inserts a new post into the database and returns its ID.
+// audienceIDs lists the followers allowed to see an almost private post and
+// listIDs the audience lists of the author it is shared with. The image of
+// the post, if any, must be a media uploaded by its author. Posts shared in a
+// group are seen by the audience of the group and are always public.
+func CreatePost(post models.Post, audienceIDs, listIDs []int) (int, error) {
+	post.Content = stripControlChars(post.Content)
+	if post.GroupID != nil {
+		post.Privacy = models.PrivacyPublic
+	}
+	if !validPrivacy(post.Privacy) {
+		return 0, ErrInvalidPrivacy
+	}
+	if post.Privacy == models.PrivacyAlmostPrivate && len(audienceIDs) == 0 && len(listIDs) == 0 {
+		return 0, ErrInvalidAudience
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkMediaOwner(tx, post.UserID, post.MediaID); err != nil {
+		return 0, err
+	}
+
 	// Inserting into the posts table
-	query := `INSERT INTO posts (user_id, content, image, privacy, created_at, updated_at) 
-              VALUES (?, ?, ?, ?, datetime('now'), datetime('now'))`
+	query := `INSERT INTO posts (user_id, content, image, privacy, media_id, group_id, created_at, updated_at)
+              VALUES (?, ?, ?, ?, ?, ?, datetime('now'), datetime('now'))`
 
-	_, err := db.DB.Exec(query, post.UserID, post.Content, post.Image, post.Privacy)
+	res, err := tx.Exec(query, post.UserID, post.Content, post.Image, post.Privacy, post.MediaID, post.GroupID)
 	if err != nil {
-		return fmt.Errorf("failed to create post: %w", err)
+		return 0, fmt.Errorf("failed to create post: %w", err)
 	}
 
+	postID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve post ID: %w", err)
+	}
+
+	if post.Privacy == models.PrivacyAlmostPrivate {
+		if err := setPostAudience(tx, int(postID), post.UserID, audienceIDs); err != nil {
+			return 0, err
+		}
+		if err := setPostAudienceLists(tx, int(postID), post.UserID, listIDs); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int(postID), nil
+}
+
+// setPostAudience stores the audience of an almost private post after checking
+// that every member of it follows the author
+func setPostAudience(tx *sql.Tx, postID, authorID int, audienceIDs []int) error {
+	for _, userID := range audienceIDs {
+		var isFollower bool
+		err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ?)`,
+			userID, authorID).Scan(&isFollower)
+		if err != nil {
+			return fmt.Errorf("failed to check follower: %w", err)
+		}
+		if !isFollower {
+			return ErrInvalidAudience
+		}
+
+		_, err = tx.Exec(`INSERT OR IGNORE INTO post_audience (post_id, user_id) VALUES (?, ?)`, postID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to add post audience: %w", err)
+		}
+	}
 	return nil
 }
 
-// GetPost retrieves a post by ID
-func GetPost(postID int) (models.Post, error) {
-	row := db.DB.QueryRow(`SELECT id, user_id, content, image, privacy, created_at, updated_at 
-		FROM posts WHERE id = ?`, postID)
+// GetPost retrieves a post by ID if viewerID is allowed to see it
+func GetPost(viewerID, postID int) (models.Post, error) {
+	visible, args := postVisibilityCondition(viewerID)
+	row := db.DB.QueryRow(`SELECT `+postColumns+`
+		FROM posts p WHERE p.id = ? AND `+visible, append([]interface{}{postID}, args...)...)
 
-	var post models.Post
-	err := row.Scan(&post.ID, &post.UserID, &post.Content, &post.Image, &post.Privacy, &post.CreatedAt, &post.UpdatedAt)
+	post, err := scanPost(row)
 	if err == sql.ErrNoRows {
-		return post, fmt.Errorf("post not found")
+		return post, ErrPostNotFound
 	} else if err != nil {
 		return post, fmt.Errorf("failed to retrieve post: %w", err)
 	}
 
-	return post, nil
+	posts := []models.Post{post}
+	if err := loadPosts(viewerID, posts, false); err != nil {
+		return post, err
+	}
+
+	return posts[0], nil
 }
 
-// GetAllPosts fetches all posts from the database
-func GetAllPosts() ([]models.Post, error) {
+// GetAllPosts fetches all the posts viewerID is allowed to see
+func GetAllPosts(viewerID int) ([]models.Post, error) {
 	// Define the SQL query
+	visible, args := postVisibilityCondition(viewerID)
 	query := `
-	SELECT id, user_id, content, image, privacy, created_at, updated_at 
-	FROM posts
-	ORDER BY created_at DESC;
+	SELECT ` + postColumns + `
+	FROM posts p
+	WHERE ` + visible + `
+	ORDER BY p.created_at DESC;
 	`
 
 	// Query the database
-	rows, err := db.DB.Query(query)
+	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query posts: %w", err)
 	}
@@ -59,8 +184,7 @@ func GetAllPosts() ([]models.Post, error) {
 
 	// Iterate over the rows and scan each row into a Post struct
 	for rows.Next() {
-		var post models.Post
-		err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.Image, &post.Privacy, &post.CreatedAt, &post.UpdatedAt)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan post: %w", err)
 		}
@@ -73,25 +197,106 @@ func GetAllPosts() ([]models.Post, error) {
 		return nil, fmt.Errorf("error iterating over posts: %w", err)
 	}
 
+	if err := loadPosts(viewerID, posts, false); err != nil {
+		return nil, err
+	}
+
 	// Return the slice of posts
 	return posts, nil
 }
 
-// UpdatePost updates the content of a post
-func UpdatePost(postID int, updatedPost models.Post) error {
-	_, err := db.DB.Exec(`UPDATE posts SET content = ?, image = ?, privacy = ?, updated_at = ? 
-		WHERE id = ?`, updatedPost.Content, updatedPost.Image, updatedPost.Privacy, time.Now(), postID)
+// UpdatePost updates the content, image and privacy of a post. The audience
+// of an almost private post is replaced by audienceIDs and listIDs, and is
+// cleared when the post no longer is almost private. Group posts stay public,
+// their group deciding who sees them.
+func UpdatePost(postID int, updatedPost models.Post, audienceIDs, listIDs []int) error {
+	if !validPrivacy(updatedPost.Privacy) {
+		return ErrInvalidPrivacy
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	var groupID sql.NullInt64
+	if err := tx.QueryRow(`SELECT user_id, group_id FROM posts WHERE id = ?`, postID).Scan(&authorID, &groupID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPostNotFound
+		}
+		return fmt.Errorf("failed to look up post: %w", err)
+	}
+	if groupID.Valid {
+		updatedPost.Privacy = models.PrivacyPublic
+	}
+	if updatedPost.Privacy == models.PrivacyAlmostPrivate && len(audienceIDs) == 0 && len(listIDs) == 0 {
+		return ErrInvalidAudience
+	}
+
+	_, err = tx.Exec(`UPDATE posts SET content = ?, image = ?, privacy = ?, updated_at = ? WHERE id = ?`,
+		stripControlChars(updatedPost.Content), updatedPost.Image, updatedPost.Privacy, time.Now(), postID)
 	if err != nil {
 		return fmt.Errorf("failed to update post: %w", err)
 	}
+
+	if _, err := tx.Exec(`DELETE FROM post_audience WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("failed to clear post audience: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM post_audience_lists WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("failed to clear post audience lists: %w", err)
+	}
+	if updatedPost.Privacy == models.PrivacyAlmostPrivate {
+		if err := setPostAudience(tx, postID, authorID, audienceIDs); err != nil {
+			return err
+		}
+		if err := setPostAudienceLists(tx, postID, authorID, listIDs); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
-// DeletePost removes a post from the database
+// DeletePost removes a post, its audience, its comments and the reactions to
+// both from the database
 func DeletePost(postID int) error {
-	_, err := db.DB.Exec(`DELETE FROM posts WHERE id = ?`, postID)
+	tx, err := db.DB.Begin()
 	if err != nil {
+		return fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM post_audience WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("failed to delete post audience: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM post_audience_lists WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("failed to delete post audience lists: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE target_type = ? AND target_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		models.ReactionTargetComment, postID); err != nil {
+		return fmt.Errorf("failed to delete comment reactions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM reaction_counts WHERE target_type = ? AND target_id IN (SELECT id FROM comments WHERE post_id = ?)`,
+		models.ReactionTargetComment, postID); err != nil {
+		return fmt.Errorf("failed to delete comment reaction counts: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM comments WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("failed to delete comments: %w", err)
+	}
+	if err := deleteReactions(tx, models.ReactionTargetPost, postID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM posts WHERE id = ?`, postID); err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidVisibility = errors.New("visibility must be everyone, followers or only_me")
+
+// validVisibility reports whether visibility is one of the supported field visibilities
+func validVisibility(visibility string) bool {
+	switch visibility {
+	case models.VisibilityEveryone, models.VisibilityFollowers, models.VisibilityOnlyMe:
+		return true
+	}
+	return false
+}
+
+// fieldVisible reports whether a field with the given visibility is shown to
+// a viewer who is the user themselves or one of their followers
+func fieldVisible(visibility string, isSelf, isFollower bool) bool {
+	switch {
+	case isSelf:
+		return true
+	case visibility == models.VisibilityEveryone:
+		return true
+	case visibility == models.VisibilityFollowers:
+		return isFollower
+	}
+	return false
+}
+
+// visibleFieldCondition returns an SQL condition that only holds when the
+// field whose visibility is in visibilityColumn, belonging to the user in
+// userColumn, is shown to viewerID, with its arguments
+func visibleFieldCondition(viewerID int, visibilityColumn, userColumn string) (string, []interface{}) {
+	condition := `(` + userColumn + ` = ? OR ` + visibilityColumn + ` = ? OR (` + visibilityColumn + ` = ? AND EXISTS (
+		SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ` + userColumn + `)))`
+	return condition, []interface{}{viewerID, models.VisibilityEveryone, models.VisibilityFollowers, viewerID}
+}
+
+// applyFieldVisibility blanks the optional fields of a profile that viewerID
+// may not see. Only the user themselves get the visibility settings back.
+func applyFieldVisibility(user *models.User, visibility models.FieldVisibility, isSelf, isFollower bool) {
+	if !fieldVisible(visibility.Email, isSelf, isFollower) {
+		user.Email = ""
+	}
+	if !fieldVisible(visibility.DateOfBirth, isSelf, isFollower) {
+		user.DateOfBirth = ""
+	}
+	if !fieldVisible(visibility.AboutMe, isSelf, isFollower) {
+		user.AboutMe = ""
+	}
+	if !fieldVisible(visibility.Nickname, isSelf, isFollower) {
+		user.Nickname = ""
+	}
+	if isSelf {
+		user.Visibility = &visibility
+	}
+}
+
+// redactUserSummaryList is redactUserSummaries over a slice of cards
+func redactUserSummaryList(viewerID int, users []models.UserSummary) error {
+	pointers := make([]*models.UserSummary, len(users))
+	for i := range users {
+		pointers[i] = &users[i]
+	}
+	return redactUserSummaries(viewerID, pointers)
+}
+
+// redactUserSummaries blanks the nicknames viewerID may not see, looking up
+// in one query whether they follow the users who show theirs to followers only
+func redactUserSummaries(viewerID int, users []*models.UserSummary) error {
+	var followersOnly []int
+	for _, user := range users {
+		if user.ID != viewerID && user.NicknameVisibility == models.VisibilityFollowers && user.Nickname != "" {
+			followersOnly = append(followersOnly, user.ID)
+		}
+	}
+
+	following := make(map[int]bool)
+	if ids := uniqueIDs(followersOnly); len(ids) > 0 {
+		args := []interface{}{viewerID}
+		for _, id := range ids {
+			args = append(args, id)
+		}
+		rows, err := db.DB.Query(`SELECT followed_id FROM followers
+			WHERE follower_id = ? AND followed_id IN (`+placeholders(len(ids))+`)`, args...)
+		if err != nil {
+			return fmt.Errorf("failed to check follow status: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				return fmt.Errorf("failed to scan follow status: %w", err)
+			}
+			following[id] = true
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error iterating over follow status: %w", err)
+		}
+	}
+
+	for _, user := range users {
+		if !fieldVisible(user.NicknameVisibility, user.ID == viewerID, following[user.ID]) {
+			user.Nickname = ""
+		}
+	}
+	return nil
+}
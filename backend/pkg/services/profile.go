@@ -9,15 +9,31 @@ import (
 	"time"
 )
 
-func GetProfile(requesterID, userID int) (models.User, []models.Post, []models.User, []models.User, error) {
+// GetProfile returns the profile of userID with the posts requesterID may see
+// and how many followers and followed users it has. Optional fields are left
+// empty when their visibility hides them from requesterID.
+func GetProfile(requesterID, userID int) (models.User, []models.Post, int, int, error) {
 	var user models.User
 
+	// Users who blocked each other cannot see each other's profile at all, and
+	// private profiles are only shown to their followers
+	if err := checkProfileAccess(requesterID, userID); err != nil {
+		return user, nil, 0, 0, err
+	}
+
+	var visibility models.FieldVisibility
+	var isFollower bool
+	var avatarMediaID sql.NullInt64
 	row := db.DB.QueryRow(`
-        SELECT id, email, first_name, last_name, date_of_birth, avatar, nickname, about_me, is_private, created_at, updated_at
-        FROM users WHERE id = ?`, userID)
+        SELECT id, COALESCE(handle, ''), email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(date_of_birth, ''), COALESCE(avatar, ''), COALESCE(nickname, ''),
+            COALESCE(about_me, ''), is_private, created_at, updated_at, avatar_media_id,
+            email_visibility, date_of_birth_visibility, about_me_visibility, nickname_visibility,
+            EXISTS(SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = users.id)
+        FROM users WHERE id = ?`, requesterID, userID)
 
 	err := row.Scan(
 		&user.ID,
+		&user.Handle,
 		&user.Email,
 		&user.FirstName,
 		&user.LastName,
@@ -28,53 +44,52 @@ func GetProfile(requesterID, userID int) (models.User, []models.Post, []models.U
 		&user.IsPrivate,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&avatarMediaID,
+		&visibility.Email,
+		&visibility.DateOfBirth,
+		&visibility.AboutMe,
+		&visibility.Nickname,
+		&isFollower,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return user, nil, nil, nil, fmt.Errorf("profile not found")
+			return user, nil, 0, 0, ErrProfileNotFound
 		}
 		log.Printf("Error retrieving profile: %v", err) // Log the detailed error
-		return user, nil, nil, nil, fmt.Errorf("failed to get profile: %w", err)
+		return user, nil, 0, 0, fmt.Errorf("failed to get profile: %w", err)
 	}
-
-	// Profile visibility check
-	if user.IsPrivate && requesterID != userID {
-		row := db.DB.QueryRow(`
-            SELECT 1 FROM followers WHERE follower_id = ? AND followed_id = ?`, requesterID, userID)
-		err = row.Scan()
-		if err == sql.ErrNoRows {
-			return user, nil, nil, nil, fmt.Errorf("profile is private and you are not a follower")
-		}
+	user.AvatarMediaID = nullableID(avatarMediaID)
+	if user.AvatarMediaID != nil {
+		images, err := loadMediaImages([]int{*user.AvatarMediaID})
 		if err != nil {
-			log.Printf("Error checking follow status: %v", err) // Log the detailed error
-			return user, nil, nil, nil, fmt.Errorf("failed to check follow status: %w", err)
+			return user, nil, 0, 0, err
 		}
+		user.AvatarImage = mediaImageOf(images, user.AvatarMediaID)
 	}
+	applyFieldVisibility(&user, visibility, requesterID == userID, isFollower)
 
-	// Fetch posts, followers, and following
-	posts, err := fetchPosts(userID)
+	// Fetch posts and follow counts. The lists themselves are paginated
+	// through ListConnections.
+	posts, err := fetchPosts(requesterID, userID)
 	if err != nil {
 		log.Printf("Error fetching posts: %v", err) // Log the detailed error
-		return user, nil, nil, nil, fmt.Errorf("failed to get posts: %w", err)
-	}
-
-	followers, err := fetchFollowers(userID)
-	if err != nil {
-		log.Printf("Error fetching followers: %v", err) // Log the detailed error
-		return user, nil, nil, nil, fmt.Errorf("failed to get followers: %w", err)
+		return user, nil, 0, 0, fmt.Errorf("failed to get posts: %w", err)
 	}
 
-	following, err := fetchFollowing(userID)
+	followerCount, followingCount, err := countConnections(userID)
 	if err != nil {
-		log.Printf("Error fetching following: %v", err) // Log the detailed error
-		return user, nil, nil, nil, fmt.Errorf("failed to get following: %w", err)
+		return user, nil, 0, 0, err
 	}
 
-	return user, posts, followers, following, nil
+	return user, posts, followerCount, followingCount, nil
 }
 
-func fetchPosts(userID int) ([]models.Post, error) {
-	rows, err := db.DB.Query(`SELECT id, user_id, content, image, privacy, created_at, updated_at FROM posts WHERE user_id = ?`, userID)
+// fetchPosts returns the posts of userID that viewerID is allowed to see,
+// with their comments
+func fetchPosts(viewerID, userID int) ([]models.Post, error) {
+	visible, args := postVisibilityCondition(viewerID)
+	rows, err := db.DB.Query(`SELECT `+postColumns+`
+		FROM posts p WHERE p.user_id = ? AND `+visible, append([]interface{}{userID}, args...)...)
 	if err != nil {
 		return nil, err
 	}
@@ -82,111 +97,115 @@ func fetchPosts(userID int) ([]models.Post, error) {
 
 	var posts []models.Post
 	for rows.Next() {
-		var post models.Post
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.Image, &post.Privacy, &post.CreatedAt, &post.UpdatedAt); err != nil {
-			return nil, err
-		}
-
-		// Fetch comments for the post
-		comments, err := fetchComments(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comments = comments
-
-		// Fetch likes count for the post
-		likes, err := fetchLikes(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Likes = likes
-
-		// Fetch dislikes count for the post
-		dislikes, err := fetchDislikes(post.ID)
+		post, err := scanPost(rows)
 		if err != nil {
 			return nil, err
 		}
-		post.Dislikes = dislikes
-
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := loadPosts(viewerID, posts, true); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
-func fetchComments(postID int) ([]models.Comment, error) {
-	rows, err := db.DB.Query(`SELECT id, user_id, post_id, content, created_at, updated_at FROM comments WHERE post_id = ?`, postID)
+// GetProfileCard returns the minimal public card of userID, shown instead of
+// a private profile to users who do not follow it
+func GetProfileCard(requesterID, userID int) (models.ProfileCard, error) {
+	card := models.ProfileCard{Restricted: true}
+
+	blocked, err := IsBlocked(requesterID, userID)
 	if err != nil {
-		return nil, err
+		return card, err
 	}
-	defer rows.Close()
-
-	var comments []models.Comment
-	for rows.Next() {
-		var comment models.Comment
-		if err := rows.Scan(&comment.ID, &comment.UserID, &comment.PostID, &comment.Content, &comment.CreatedAt, &comment.UpdatedAt); err != nil {
-			return nil, err
-		}
-		comments = append(comments, comment)
+	if blocked {
+		return card, ErrProfileNotFound
 	}
-	return comments, nil
-}
 
-func fetchLikes(postID int) (int, error) {
-	var count int
-	err := db.DB.QueryRow(`SELECT COUNT(*) FROM likes WHERE post_id = ?`, postID).Scan(&count)
-	return count, err
-}
+	users, err := loadUserSummaries(requesterID, []int{userID})
+	if err != nil {
+		return card, err
+	}
+	user, ok := users[userID]
+	if !ok {
+		return card, ErrProfileNotFound
+	}
+	card.User = user
 
-func fetchDislikes(postID int) (int, error) {
-	var count int
-	err := db.DB.QueryRow(`SELECT COUNT(*) FROM dislikes WHERE post_id = ?`, postID).Scan(&count)
-	return count, err
+	if card.FollowerCount, _, err = countConnections(userID); err != nil {
+		return card, err
+	}
+	return card, nil
 }
 
-func fetchFollowers(userID int) ([]models.User, error) {
-	rows, err := db.DB.Query(`SELECT u.id, u.email, u.first_name, u.last_name, u.date_of_birth, u.avatar, u.nickname, u.about_me, u.is_private, u.created_at, u.updated_at
-        FROM followers f JOIN users u ON f.follower_id = u.id WHERE f.followed_id = ?`, userID)
+// UpdateProfile updates a user's profile. When the account switches from
+// private to public, its pending follow requests are accepted. The visibility
+// of optional fields is only changed for the fields set in Visibility. An
+// avatar set through AvatarMediaID must have been uploaded by the user.
+func UpdateProfile(userID int, updatedProfile models.User) error {
+	tx, err := db.DB.Begin()
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("could not start transaction: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var followers []models.User
-	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.DateOfBirth, &user.Avatar, &user.Nickname, &user.AboutMe, &user.IsPrivate, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			return nil, err
+	var wasPrivate bool
+	if err := tx.QueryRow(`SELECT is_private FROM users WHERE id = ?`, userID).Scan(&wasPrivate); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrUserNotFound
 		}
-		followers = append(followers, user)
+		return fmt.Errorf("failed to get profile: %w", err)
+	}
+	if err := checkMediaOwner(tx, userID, updatedProfile.AvatarMediaID); err != nil {
+		return err
 	}
-	return followers, nil
-}
 
-func fetchFollowing(userID int) ([]models.User, error) {
-	rows, err := db.DB.Query(`SELECT u.id, u.email, u.first_name, u.last_name, u.date_of_birth, u.avatar, u.nickname, u.about_me, u.is_private, u.created_at, u.updated_at
-        FROM followers f JOIN users u ON f.followed_id = u.id WHERE f.follower_id = ?`, userID)
+	_, err = tx.Exec(`UPDATE users SET first_name = ?, last_name = ?, date_of_birth = ?, avatar = ?, avatar_media_id = ?, nickname = ?, about_me = ?, is_private = ?, updated_at = ? 
+        WHERE id = ?`, stripControlChars(updatedProfile.FirstName), stripControlChars(updatedProfile.LastName), updatedProfile.DateOfBirth, updatedProfile.Avatar, updatedProfile.AvatarMediaID, stripControlChars(updatedProfile.Nickname), updatedProfile.AboutMe, updatedProfile.IsPrivate, time.Now(), userID)
 	if err != nil {
-		return nil, err
+		log.Printf("Error updating profile: %v", err) // Log the detailed error
+		return fmt.Errorf("failed to update profile: %w", err)
 	}
-	defer rows.Close()
 
-	var following []models.User
-	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.FirstName, &user.LastName, &user.DateOfBirth, &user.Avatar, &user.Nickname, &user.AboutMe, &user.IsPrivate, &user.CreatedAt, &user.UpdatedAt); err != nil {
-			return nil, err
+	if visibility := updatedProfile.Visibility; visibility != nil {
+		if err := updateFieldVisibility(tx, userID, *visibility); err != nil {
+			return err
 		}
-		following = append(following, user)
 	}
-	return following, nil
+
+	if wasPrivate && !updatedProfile.IsPrivate {
+		if err := acceptPendingFollowRequests(tx, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
 }
 
-func UpdateProfile(userID int, updatedProfile models.User) error {
-	_, err := db.DB.Exec(`UPDATE users SET first_name = ?, last_name = ?, date_of_birth = ?, avatar = ?, nickname = ?, about_me = ?, is_private = ?, updated_at = ? 
-        WHERE id = ?`, updatedProfile.FirstName, updatedProfile.LastName, updatedProfile.DateOfBirth, updatedProfile.Avatar, updatedProfile.Nickname, updatedProfile.AboutMe, updatedProfile.IsPrivate, time.Now(), userID)
+// updateFieldVisibility changes the visibility of the optional fields of a
+// profile, leaving the fields with an empty visibility unchanged
+func updateFieldVisibility(tx *sql.Tx, userID int, visibility models.FieldVisibility) error {
+	for _, value := range []string{visibility.Email, visibility.DateOfBirth, visibility.AboutMe, visibility.Nickname} {
+		if value != "" && !validVisibility(value) {
+			return ErrInvalidVisibility
+		}
+	}
+
+	_, err := tx.Exec(`UPDATE users SET
+		email_visibility = COALESCE(NULLIF(?, ''), email_visibility),
+		date_of_birth_visibility = COALESCE(NULLIF(?, ''), date_of_birth_visibility),
+		about_me_visibility = COALESCE(NULLIF(?, ''), about_me_visibility),
+		nickname_visibility = COALESCE(NULLIF(?, ''), nickname_visibility)
+		WHERE id = ?`, visibility.Email, visibility.DateOfBirth, visibility.AboutMe, visibility.Nickname, userID)
 	if err != nil {
-		log.Printf("Error updating profile: %v", err) // Log the detailed error
-		return fmt.Errorf("failed to update profile: %w", err)
+		return fmt.Errorf("failed to update field visibility: %w", err)
 	}
 	return nil
 }
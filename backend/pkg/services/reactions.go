@@ -0,0 +1,239 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidReactionType   = errors.New("invalid reaction type")
+	ErrInvalidReactionTarget = errors.New("target type must be post, comment or message")
+)
+
+var reactionTypes = map[string]bool{
+	models.ReactionLike:    true,
+	models.ReactionDislike: true,
+	models.ReactionLove:    true,
+	models.ReactionHaha:    true,
+	models.ReactionWow:     true,
+	models.ReactionSad:     true,
+	models.ReactionAngry:   true,
+}
+
+// ValidReactionTarget reports whether users can react to targetType
+func ValidReactionTarget(targetType string) bool {
+	switch targetType {
+	case models.ReactionTargetPost, models.ReactionTargetComment, models.ReactionTargetMessage:
+		return true
+	}
+	return false
+}
+
+// ToggleReaction records the reaction of userID to a target. Reacting again
+// with the same type removes the reaction and reacting with another type
+// replaces it, as users have at most one reaction per target.
+func ToggleReaction(userID int, targetType string, targetID int, reactionType string) (models.ReactionSummary, error) {
+	if !ValidReactionTarget(targetType) {
+		return models.ReactionSummary{}, ErrInvalidReactionTarget
+	}
+	if !reactionTypes[reactionType] {
+		return models.ReactionSummary{}, ErrInvalidReactionType
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.ReactionSummary{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(`SELECT type FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+		userID, targetType, targetID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return models.ReactionSummary{}, fmt.Errorf("failed to look up reaction: %w", err)
+	}
+
+	if current == reactionType {
+		_, err = tx.Exec(`DELETE FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ?`,
+			userID, targetType, targetID)
+	} else {
+		_, err = tx.Exec(`INSERT INTO reactions (user_id, target_type, target_id, type, created_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (user_id, target_type, target_id) DO UPDATE SET type = excluded.type, created_at = excluded.created_at`,
+			userID, targetType, targetID, reactionType, time.Now())
+	}
+	if err != nil {
+		return models.ReactionSummary{}, fmt.Errorf("failed to save reaction: %w", err)
+	}
+
+	if current != "" {
+		if err := adjustReactionCount(tx, targetType, targetID, current, -1); err != nil {
+			return models.ReactionSummary{}, err
+		}
+	}
+	if current != reactionType {
+		if err := adjustReactionCount(tx, targetType, targetID, reactionType, 1); err != nil {
+			return models.ReactionSummary{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ReactionSummary{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return GetReactionSummary(userID, targetType, targetID)
+}
+
+// RemoveReaction removes the reaction of userID to a target, if any
+func RemoveReaction(userID int, targetType string, targetID int) (models.ReactionSummary, error) {
+	if !ValidReactionTarget(targetType) {
+		return models.ReactionSummary{}, ErrInvalidReactionTarget
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return models.ReactionSummary{}, fmt.Errorf("could not start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRow(`DELETE FROM reactions WHERE user_id = ? AND target_type = ? AND target_id = ? RETURNING type`,
+		userID, targetType, targetID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return models.ReactionSummary{}, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	if current != "" {
+		if err := adjustReactionCount(tx, targetType, targetID, current, -1); err != nil {
+			return models.ReactionSummary{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.ReactionSummary{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return GetReactionSummary(userID, targetType, targetID)
+}
+
+// GetReactionSummary counts the reactions to a target and finds the one of viewerID
+func GetReactionSummary(viewerID int, targetType string, targetID int) (models.ReactionSummary, error) {
+	summary := models.ReactionSummary{TargetType: targetType, TargetID: targetID}
+	if !ValidReactionTarget(targetType) {
+		return summary, ErrInvalidReactionTarget
+	}
+
+	counts, viewerReactions, err := loadReactions(viewerID, targetType, []int{targetID})
+	if err != nil {
+		return summary, err
+	}
+	summary.Counts = counts[targetID]
+	summary.ViewerReaction = viewerReactions[targetID]
+	return summary, nil
+}
+
+// loadReactions reads the number of reactions of each type to the given
+// targets from their counters, and finds the reaction of viewerID to each of
+// them, in two queries whatever the number of targets. Every target gets a
+// counts map, empty when nobody reacted.
+func loadReactions(viewerID int, targetType string, targetIDs []int) (map[int]map[string]int, map[int]string, error) {
+	counts := make(map[int]map[string]int, len(targetIDs))
+	viewerReactions := make(map[int]string)
+	if len(targetIDs) == 0 {
+		return counts, viewerReactions, nil
+	}
+
+	args := []interface{}{targetType}
+	for _, id := range targetIDs {
+		counts[id] = map[string]int{}
+		args = append(args, id)
+	}
+
+	rows, err := db.DB.Query(`SELECT target_id, type, count FROM reaction_counts
+		WHERE target_type = ? AND target_id IN (`+placeholders(len(targetIDs))+`) AND count > 0`, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load reaction counts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var targetID, count int
+		var reactionType string
+		if err := rows.Scan(&targetID, &reactionType, &count); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan reaction counts: %w", err)
+		}
+		counts[targetID][reactionType] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating over reaction counts: %w", err)
+	}
+
+	viewerRows, err := db.DB.Query(`SELECT target_id, type FROM reactions
+		WHERE user_id = ? AND target_type = ? AND target_id IN (`+placeholders(len(targetIDs))+`)`,
+		append([]interface{}{viewerID}, args...)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load viewer reactions: %w", err)
+	}
+	defer viewerRows.Close()
+
+	for viewerRows.Next() {
+		var targetID int
+		var reactionType string
+		if err := viewerRows.Scan(&targetID, &reactionType); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan viewer reactions: %w", err)
+		}
+		viewerReactions[targetID] = reactionType
+	}
+	return counts, viewerReactions, viewerRows.Err()
+}
+
+// attachPostReactions fills in the reactions of posts as seen by viewerID
+func attachPostReactions(viewerID int, posts []models.Post) error {
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	counts, viewerReactions, err := loadReactions(viewerID, models.ReactionTargetPost, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Reactions = counts[posts[i].ID]
+		posts[i].ViewerReaction = viewerReactions[posts[i].ID]
+	}
+	return nil
+}
+
+// attachCommentReactions fills in the reactions of comments as seen by viewerID
+func attachCommentReactions(viewerID int, comments []models.Comment) error {
+	ids := make([]int, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	counts, viewerReactions, err := loadReactions(viewerID, models.ReactionTargetComment, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].Reactions = counts[comments[i].ID]
+		comments[i].ViewerReaction = viewerReactions[comments[i].ID]
+	}
+	return nil
+}
+
+// deleteReactions removes the reactions to a target that no longer exists
+func deleteReactions(tx *sql.Tx, targetType string, targetID int) error {
+	if _, err := tx.Exec(`DELETE FROM reactions WHERE target_type = ? AND target_id = ?`, targetType, targetID); err != nil {
+		return fmt.Errorf("failed to delete reactions: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM reaction_counts WHERE target_type = ? AND target_id = ?`, targetType, targetID); err != nil {
+		return fmt.Errorf("failed to delete reaction counts: %w", err)
+	}
+	return nil
+}
+
+// placeholders returns n comma separated SQL placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
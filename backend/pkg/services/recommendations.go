@@ -0,0 +1,120 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"fmt"
+)
+
+const (
+	DefaultRecommendationLimit = 20
+	MaxRecommendationLimit     = 50
+)
+
+// recommendationQuery ranks the accounts connected to the viewer through the
+// follow graph and their groups. Each branch of signals only walks indexed
+// edges next to the viewer, so the cost grows with the size of their
+// neighbourhood rather than with the whole graph. The weighted score favours
+// accounts followed by people the viewer follows, then shared groups.
+const recommendationQuery = `WITH
+	following AS (SELECT followed_id AS id FROM followers WHERE follower_id = ?),
+	my_followers AS (SELECT follower_id AS id FROM followers WHERE followed_id = ?),
+	my_groups AS (SELECT group_id FROM group_memberships WHERE user_id = ? AND left_at IS NULL),
+	signals (candidate_id, via_following, via_followers, via_groups, follows_you) AS (
+		SELECT f.followed_id, 1, 0, 0, 0 FROM followers f WHERE f.follower_id IN (SELECT id FROM following)
+		UNION ALL
+		SELECT f.followed_id, 0, 1, 0, 0 FROM followers f WHERE f.follower_id IN (SELECT id FROM my_followers)
+		UNION ALL
+		SELECT gm.user_id, 0, 0, 1, 0 FROM group_memberships gm
+		WHERE gm.group_id IN (SELECT group_id FROM my_groups) AND gm.left_at IS NULL
+		UNION ALL
+		SELECT id, 0, 0, 0, 1 FROM my_followers
+	),
+	candidates AS (
+		SELECT candidate_id, SUM(via_following) AS via_following, SUM(via_followers) AS via_followers,
+			SUM(via_groups) AS via_groups, MAX(follows_you) AS follows_you
+		FROM signals GROUP BY candidate_id
+	)
+SELECT ` + userSummaryColumns + `, c.via_following, c.via_followers, c.via_groups, c.follows_you
+FROM candidates c JOIN users u ON u.id = c.candidate_id
+WHERE c.candidate_id != ?
+	AND c.candidate_id NOT IN (SELECT id FROM following)
+	AND NOT EXISTS (SELECT 1 FROM follow_requests fr WHERE fr.status = ?
+		AND ((fr.sender_id = ? AND fr.recipient_id = c.candidate_id) OR (fr.sender_id = c.candidate_id AND fr.recipient_id = ?)))
+	AND %s AND %s
+ORDER BY 3 * c.via_following + 2 * c.via_groups + c.via_followers + 2 * c.follows_you DESC, c.candidate_id
+LIMIT ? OFFSET ?`
+
+// GetRecommendations suggests accounts viewerID may know: accounts followed by
+// people they follow, accounts their followers follow, members of their groups
+// and followers they do not follow back. Accounts they already follow or have
+// a pending follow request with, and blocked or muted accounts, are left out.
+func GetRecommendations(viewerID, offset, limit int) ([]models.Recommendation, error) {
+	if limit <= 0 {
+		limit = DefaultRecommendationLimit
+	} else if limit > MaxRecommendationLimit {
+		limit = MaxRecommendationLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	notBlocked, blockArgs := blockCondition(viewerID, "c.candidate_id")
+	notMuted, muteArgs := mutedUserCondition(viewerID, "c.candidate_id")
+	args := []interface{}{viewerID, viewerID, viewerID, viewerID, models.FollowRequestPending, viewerID, viewerID}
+	args = append(append(append(args, blockArgs...), muteArgs...), limit, offset)
+
+	rows, err := db.DB.Query(fmt.Sprintf(recommendationQuery, notBlocked, notMuted), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recommendations: %w", err)
+	}
+	defer rows.Close()
+
+	recommendations := []models.Recommendation{}
+	for rows.Next() {
+		var rec models.Recommendation
+		rec.User, err = scanUserSummary(rows, &rec.FollowedByFollowing, &rec.MutualFollowers, &rec.SharedGroups, &rec.FollowsYou)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recommendation: %w", err)
+		}
+		rec.Reasons = recommendationReasons(rec)
+		recommendations = append(recommendations, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over recommendations: %w", err)
+	}
+
+	users := make([]*models.UserSummary, len(recommendations))
+	for i := range recommendations {
+		users[i] = &recommendations[i].User
+	}
+	if err := redactUserSummaries(viewerID, users); err != nil {
+		return nil, err
+	}
+	return recommendations, nil
+}
+
+// recommendationReasons describes the signals of a recommendation, strongest first
+func recommendationReasons(rec models.Recommendation) []string {
+	var reasons []string
+	if rec.FollowedByFollowing > 0 {
+		reasons = append(reasons, fmt.Sprintf("followed by %s you follow", pluralize(rec.FollowedByFollowing, "person", "people")))
+	}
+	if rec.SharedGroups > 0 {
+		reasons = append(reasons, fmt.Sprintf("%s in common", pluralize(rec.SharedGroups, "group", "groups")))
+	}
+	if rec.FollowsYou {
+		reasons = append(reasons, "follows you")
+	}
+	if rec.MutualFollowers > 0 {
+		reasons = append(reasons, fmt.Sprintf("followed by %d of your followers", rec.MutualFollowers))
+	}
+	return reasons
+}
+
+func pluralize(n int, singular, plural string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s", singular)
+	}
+	return fmt.Sprintf("%d %s", n, plural)
+}
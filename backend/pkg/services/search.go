@@ -0,0 +1,241 @@
+package services
+
+import (
+	"Social/pkg/db"
+	"Social/pkg/models"
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 50
+
+	// maxSearchTerms bounds the size of the FTS query built from user input
+	maxSearchTerms = 10
+
+	// Markers placed around matched terms by snippet(). Control characters
+	// are stripped from the indexed text when it is written, so these only
+	// come from snippet() and are swapped for <mark> tags after escaping.
+	snippetOpen  = "\x02"
+	snippetClose = "\x03"
+)
+
+var (
+	ErrEmptySearchQuery  = errors.New("search query must contain at least one word")
+	ErrInvalidSearchType = errors.New("search type must be posts, users or groups")
+)
+
+// Search runs query against the posts, users and groups viewerID may see.
+// searchType restricts the search to one kind of result when not empty.
+// Every word of the query must match, the last letters of words being
+// optional so that partial words match too.
+func Search(viewerID int, query, searchType string, offset, limit int) (models.SearchResults, error) {
+	var results models.SearchResults
+
+	match := buildMatchQuery(query)
+	if match == "" {
+		return results, ErrEmptySearchQuery
+	}
+
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	} else if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var err error
+	switch searchType {
+	case "":
+		if results.Posts, err = searchPosts(viewerID, match, offset, limit); err != nil {
+			return results, err
+		}
+		if results.Users, err = searchUsers(viewerID, match, offset, limit); err != nil {
+			return results, err
+		}
+		results.Groups, err = searchGroups(viewerID, match, offset, limit)
+	case "posts":
+		results.Posts, err = searchPosts(viewerID, match, offset, limit)
+	case "users":
+		results.Users, err = searchUsers(viewerID, match, offset, limit)
+	case "groups":
+		results.Groups, err = searchGroups(viewerID, match, offset, limit)
+	default:
+		return results, ErrInvalidSearchType
+	}
+	return results, err
+}
+
+// buildMatchQuery turns free text into an FTS5 query matching every word as a
+// prefix. Only letters and digits are kept so that user input can never use
+// the FTS5 query syntax.
+func buildMatchQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " ")
+}
+
+func searchPosts(viewerID int, match string, offset, limit int) ([]models.SearchResult, error) {
+	visible, visibleArgs := postVisibilityCondition(viewerID)
+	query := `
+	SELECT ` + postColumns + `,
+		snippet(posts_fts, 0, ?, ?, '…', 16)
+	FROM posts_fts
+	JOIN posts p ON p.id = posts_fts.rowid
+	WHERE posts_fts MATCH ? AND ` + visible + `
+	ORDER BY bm25(posts_fts)
+	LIMIT ? OFFSET ?`
+
+	args := []interface{}{snippetOpen, snippetClose, match}
+	args = append(args, visibleArgs...)
+	args = append(args, limit, offset)
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search posts: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []models.Post
+	var snippets []string
+	for rows.Next() {
+		var snippet string
+		post, err := scanPost(rows, &snippet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan post: %w", err)
+		}
+		posts = append(posts, post)
+		snippets = append(snippets, snippet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over posts: %w", err)
+	}
+
+	if err := loadPosts(viewerID, posts, false); err != nil {
+		return nil, err
+	}
+	results := make([]models.SearchResult, len(posts))
+	for i := range posts {
+		results[i] = models.SearchResult{Snippet: formatSnippet(snippets[i]), Post: &posts[i]}
+	}
+	return results, nil
+}
+
+// searchUsers matches names and nicknames. Everyone can find any account
+// but those blocking the viewer or blocked by them; private accounts only
+// expose their public card. Nicknames hidden from the viewer are neither
+// matched nor shown in the snippet.
+func searchUsers(viewerID int, match string, offset, limit int) ([]models.SearchResult, error) {
+	notBlocked, blockArgs := blockCondition(viewerID, "u.id")
+	nicknameVisible, nicknameArgs := visibleFieldCondition(viewerID, "u.nickname_visibility", "u.id")
+	args := append([]interface{}{}, nicknameArgs...)
+	args = append(args, snippetOpen, snippetClose, snippetOpen, snippetClose, snippetOpen, snippetClose, match)
+	args = append(args, blockArgs...)
+	args = append(args, nicknameArgs...)
+	args = append(args, "{first_name last_name} : ("+match+")", limit, offset)
+
+	rows, err := db.DB.Query(`
+	SELECT `+userSummaryColumns+`,
+		CASE WHEN `+nicknameVisible+` THEN snippet(users_fts, -1, ?, ?, '…', 8)
+			ELSE COALESCE(highlight(users_fts, 0, ?, ?), '') || ' ' || COALESCE(highlight(users_fts, 1, ?, ?), '') END
+	FROM users_fts
+	JOIN users u ON u.id = users_fts.rowid
+	WHERE users_fts MATCH ? AND `+notBlocked+`
+		AND (`+nicknameVisible+` OR u.id IN (SELECT rowid FROM users_fts WHERE users_fts MATCH ?))
+	ORDER BY bm25(users_fts)
+	LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var snippet string
+		user, err := scanUserSummary(rows, &snippet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		results = append(results, models.SearchResult{Snippet: formatSnippet(snippet), User: &user})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over users: %w", err)
+	}
+
+	users := make([]*models.UserSummary, len(results))
+	for i := range results {
+		users[i] = results[i].User
+	}
+	if err := redactUserSummaries(viewerID, users); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// searchGroups matches group titles and descriptions, titles weighing more.
+// Secret groups are only found by their members and invitees.
+func searchGroups(viewerID int, match string, offset, limit int) ([]models.SearchResult, error) {
+	visible, visibleArgs := groupVisibilityCondition(viewerID)
+	args := []interface{}{snippetOpen, snippetClose, match}
+	args = append(args, visibleArgs...)
+	args = append(args, limit, offset)
+
+	rows, err := db.DB.Query(`
+	SELECT g.id, g.creator_id, g.title, COALESCE(g.description, ''), g.visibility, g.created_at, g.updated_at,
+		snippet(groups_fts, -1, ?, ?, '…', 16)
+	FROM groups_fts
+	JOIN groups g ON g.id = groups_fts.rowid
+	WHERE groups_fts MATCH ? AND `+visible+`
+	ORDER BY bm25(groups_fts, 2.0, 1.0)
+	LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search groups: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.SearchResult
+	for rows.Next() {
+		var group models.Group
+		var snippet string
+		if err := rows.Scan(&group.ID, &group.CreatorID, &group.Title, &group.Description, &group.Visibility,
+			&group.CreatedAt, &group.UpdatedAt, &snippet); err != nil {
+			return nil, fmt.Errorf("failed to scan group: %w", err)
+		}
+		results = append(results, models.SearchResult{Snippet: formatSnippet(snippet), Group: &group})
+	}
+	return results, rows.Err()
+}
+
+// stripControlChars removes the C0 control characters from text written to a
+// searchable field, keeping tabs and line breaks. Search snippets use some of
+// them as markers, which stored text must never forge.
+func stripControlChars(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// formatSnippet escapes a snippet for HTML and highlights its matched terms
+func formatSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetOpen, "<mark>")
+	return strings.ReplaceAll(snippet, snippetClose, "</mark>")
+}
@@ -10,12 +10,13 @@ import (
 	"time"
 )
 
-// FindOrCreateUserByEmail finds a user by email or creates a new one
+// FindOrCreateUserByEmail finds a user by email or creates a new one. New
+// users have no handle until they pick one during onboarding.
 func FindOrCreateUserByEmail(email, provider string) (models.User, error) {
 	var user models.User
 
 	// Attempt to find user in the database
-	err := db.DB.QueryRow("SELECT id, email FROM users WHERE email = ?", email).Scan(&user.ID, &user.Email)
+	err := db.DB.QueryRow("SELECT id, email, COALESCE(handle, '') FROM users WHERE email = ?", email).Scan(&user.ID, &user.Email, &user.Handle)
 	if err == nil {
 		return user, nil
 	} else if err != sql.ErrNoRows {
@@ -30,7 +31,7 @@ func FindOrCreateUserByEmail(email, provider string) (models.User, error) {
 	}
 
 	// Retrieve the newly created user
-	err = db.DB.QueryRow("SELECT id, email FROM users WHERE email = ?", email).Scan(&user.ID, &user.Email)
+	err = db.DB.QueryRow("SELECT id, email, COALESCE(handle, '') FROM users WHERE email = ?", email).Scan(&user.ID, &user.Email, &user.Handle)
 	if err != nil {
 		return user, fmt.Errorf("error retrieving newly created user: %w", err)
 	}
@@ -0,0 +1,22 @@
+// Package storage keeps the bytes of uploaded media behind an interface, so
+// that the local filesystem can be swapped for another blob store.
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+var (
+	ErrBlobNotFound = errors.New("blob not found")
+	ErrBlobExists   = errors.New("blob already exists")
+	ErrInvalidKey   = errors.New("invalid blob key")
+)
+
+// BlobStore stores blobs under opaque keys. Keys are generated by the caller
+// and never overwritten: Put fails with ErrBlobExists when the key is in use.
+type BlobStore interface {
+	Put(key string, r io.Reader) error
+	Open(key string) (io.ReadSeekCloser, error)
+	Delete(key string) error
+}